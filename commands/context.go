@@ -0,0 +1,303 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/executable"
+	"github.com/ajdnik/kube-cli/filesystem"
+	"github.com/ajdnik/kube-cli/ui"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+// Files larger than this are reported when build.maxFileSize isn't set.
+const defaultMaxFileSize = "10MB"
+
+// Name patterns of files which likely contain secrets.
+var secretPatterns = []string{".env", ".env.*", "*.pem", "*.key", "*.p12", "*.pfx", "id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", ".netrc", ".npmrc", ".pypirc"}
+
+// Name patterns of files matching secretPatterns which are meant to be shared.
+var secretExceptions = []string{".env.example", ".env.sample", ".env.template", ".env.dist"}
+
+var contextTop int
+
+// ContextCommand prints a summary of the project files uploaded by deploy.
+var ContextCommand = &cobra.Command{
+	Use:   "context [service...]",
+	Short: "Show build context summary",
+	Long: `Show a summary of the project files uploaded to build the Docker
+image, including the largest files and directories and warnings about large
+files or files which likely contain secrets.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if contextTop < 0 {
+			ui.FailMessage(fmt.Sprintf("Top '%v' isn't valid, it must be zero or a positive number like 10.", contextTop))
+			return errors.New("invalid top")
+		}
+		// Get project root directory
+		cwd, err := executable.GetCwd()
+		if err != nil {
+			ui.FailMessage("Please, retry 'kube-cli context' command.")
+			return err
+		}
+		// Parse project YAML config if it exists
+		var cfg config.Data
+		cp, err := config.GetPath(cwd)
+		if err == nil {
+			cfg, err = config.Read(cp)
+			if err != nil {
+				ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
+				return err
+			}
+		}
+		maxSize, err := maxFileSize(cfg)
+		if err != nil {
+			ui.FailMessage("Build Max File Size must be a size like '10MB'. Try running 'kube-cli validate' to make sure the file is valid.")
+			return err
+		}
+		services, err := selectServices(cfg, args)
+		if err != nil {
+			ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
+			return err
+		}
+		for i, svc := range services {
+			if len(services) > 1 {
+				if i > 0 {
+					ui.Message("")
+				}
+				ui.Message(fmt.Sprintf("Service %v:", svc.Name))
+			}
+			err = showContextReport(cwd, svc.Docker, maxSize)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// Collect and print the summary of files in a service build context.
+func showContextReport(cwd string, docker config.DockerData, maxSize uint64) error {
+	dir := contextDir(cwd, docker)
+	df, err := contextDockerfile(cwd, docker)
+	if err != nil {
+		ui.FailMessage(fmt.Sprintf("Dockerfile %v must be inside of the build context %v.", dockerfilePath(cwd, docker), dir))
+		return err
+	}
+	// Load .kubecliignore and .dockerignore rules
+	ignore, err := newIgnoreMatcher(dir, df)
+	if err != nil {
+		ui.FailMessage(fmt.Sprintf("Couldn't apply ignore rules from .kubecliignore and .dockerignore files: %v.", err))
+		return err
+	}
+	// Generate project files list without ignored files and directories
+	files, err := filesystem.GlobParallel(dir, ignore.Ignore, runtime.NumCPU())
+	if err != nil {
+		ui.FailMessage("Please, retry 'kube-cli context' command as an administrator.")
+		return err
+	}
+	// Directories walked only for .dockerignore exceptions are left out when empty
+	files, err = ignore.Prune(files)
+	if err != nil {
+		ui.FailMessage("Please, retry 'kube-cli context' command as an administrator.")
+		return err
+	}
+	report, err := newContextReport(files, dir, maxSize)
+	if err != nil {
+		ui.FailMessage("Please, retry 'kube-cli context' command as an administrator.")
+		return err
+	}
+	ui.Message(fmt.Sprintf("Build context contains %v files, %v in total.", report.Files, humanize.Bytes(report.Size)))
+	if len(report.LargestFiles) > 0 && contextTop > 0 {
+		ui.Message("\nLargest files:")
+		for _, e := range topEntries(report.LargestFiles, contextTop) {
+			ui.Message(fmt.Sprintf("  %10v  %v", humanize.Bytes(e.Size), e.Path))
+		}
+	}
+	if len(report.LargestDirs) > 0 && contextTop > 0 {
+		ui.Message("\nLargest directories:")
+		for _, e := range topEntries(report.LargestDirs, contextTop) {
+			ui.Message(fmt.Sprintf("  %10v  %v", humanize.Bytes(e.Size), e.Path))
+		}
+	}
+	warnings := contextWarnings(report, maxSize)
+	if len(warnings) > 0 {
+		ui.Message("")
+	}
+	for _, w := range warnings {
+		ui.WarnMessage(w)
+	}
+	return nil
+}
+
+// This function is only executed once after the package is imported.
+func init() {
+	ContextCommand.Flags().IntVarP(&contextTop, "top", "t", 10, "number of largest files and directories to show")
+}
+
+// contextEntry is a file or directory in the build context and its size.
+type contextEntry struct {
+	Path string
+	Size uint64
+}
+
+// contextReport summarizes the files in the build context.
+type contextReport struct {
+	Files        int
+	Size         uint64
+	LargestFiles []contextEntry
+	LargestDirs  []contextEntry
+	LargeFiles   []contextEntry
+	Secrets      []string
+}
+
+// Summarize project files, paths in the report are relative to the build context directory.
+func newContextReport(files []string, dir string, maxSize uint64) (contextReport, error) {
+	var report contextReport
+	dirs := make(map[string]uint64)
+	for _, f := range files {
+		stat, err := os.Lstat(f)
+		if err != nil {
+			return report, err
+		}
+		if stat.IsDir() {
+			continue
+		}
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return report, err
+		}
+		size := uint64(stat.Size())
+		report.Files++
+		report.Size += size
+		report.LargestFiles = append(report.LargestFiles, contextEntry{Path: rel, Size: size})
+		if size > maxSize {
+			report.LargeFiles = append(report.LargeFiles, contextEntry{Path: rel, Size: size})
+		}
+		// Count the file size towards every parent directory
+		for d := filepath.Dir(rel); d != "."; d = filepath.Dir(d) {
+			dirs[d] += size
+		}
+		if stat.Mode().IsRegular() && likelySecret(f) {
+			report.Secrets = append(report.Secrets, rel)
+		}
+	}
+	for d, size := range dirs {
+		report.LargestDirs = append(report.LargestDirs, contextEntry{Path: d + string(filepath.Separator), Size: size})
+	}
+	sortEntries(report.LargestFiles)
+	sortEntries(report.LargestDirs)
+	sortEntries(report.LargeFiles)
+	sort.Strings(report.Secrets)
+	return report, nil
+}
+
+// Describe large files and files which likely contain secrets.
+func contextWarnings(report contextReport, maxSize uint64) []string {
+	var warnings []string
+	for _, e := range report.LargeFiles {
+		warnings = append(warnings, fmt.Sprintf("%v is %v, which is larger than %v. Add it to .kubecliignore or .dockerignore if the build doesn't need it.", e.Path, humanize.Bytes(e.Size), humanize.Bytes(maxSize)))
+	}
+	for _, s := range report.Secrets {
+		warnings = append(warnings, fmt.Sprintf("%v likely contains secrets and will be uploaded. Add it to .kubecliignore or .dockerignore if the build doesn't need it.", s))
+	}
+	return warnings
+}
+
+// Directory used as the Docker build context.
+func contextDir(cwd string, docker config.DockerData) string {
+	return filepath.Join(cwd, docker.Context)
+}
+
+// Path of the Dockerfile, defaults to Dockerfile in the build context.
+func dockerfilePath(cwd string, docker config.DockerData) string {
+	if len(docker.Dockerfile) > 0 {
+		return filepath.Join(cwd, docker.Dockerfile)
+	}
+	return filepath.Join(contextDir(cwd, docker), "Dockerfile")
+}
+
+// Path of the Dockerfile relative to the build context, as expected by docker build.
+func contextDockerfile(cwd string, docker config.DockerData) (string, error) {
+	rel, err := filepath.Rel(contextDir(cwd, docker), dockerfilePath(cwd, docker))
+	if err != nil {
+		return rel, err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel, errors.New("dockerfile is outside of the build context")
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Parse the build.maxFileSize option.
+func maxFileSize(cfg config.Data) (uint64, error) {
+	size := cfg.Build.MaxFileSize
+	if len(size) == 0 {
+		size = defaultMaxFileSize
+	}
+	return humanize.ParseBytes(size)
+}
+
+// Check if a file likely contains secrets based on its name, JSON files are
+// checked for Google service account keys.
+func likelySecret(path string) bool {
+	name := filepath.Base(path)
+	for _, p := range secretExceptions {
+		if name == p {
+			return false
+		}
+	}
+	for _, p := range secretPatterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	if strings.HasSuffix(name, ".json") {
+		ok, _ := serviceAccountKey(path)
+		return ok
+	}
+	return false
+}
+
+// Check if a JSON file is a Google service account key.
+func serviceAccountKey(path string) (bool, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	// Service account keys are small, don't read large data files
+	if stat.Size() > 64*1024 {
+		return false, errors.New("file too large")
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	content := string(b)
+	return strings.Contains(content, "\"service_account\"") && strings.Contains(content, "\"private_key\""), nil
+}
+
+// Sort entries from the largest to the smallest.
+func sortEntries(entries []contextEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Size == entries[j].Size {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Size > entries[j].Size
+	})
+}
+
+// Return at most n entries.
+func topEntries(entries []contextEntry, n int) []contextEntry {
+	if n < len(entries) {
+		return entries[:n]
+	}
+	return entries
+}
@@ -0,0 +1,288 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/executable"
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
+	"github.com/spf13/cobra"
+)
+
+var asyncControl bool
+var confirmedControl bool
+
+// ScaleCommand sets the number of replicas of the workload running the project.
+var ScaleCommand = &cobra.Command{
+	Use:   "scale replicas [service...]",
+	Short: "Scale deployment",
+	Long: `Set the number of replicas of the main workload of each service, which
+has to be a Deployment or a StatefulSet.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		replicas, err := strconv.ParseInt(args[0], 10, 32)
+		if err != nil || replicas < 0 {
+			ui.FailMessage(fmt.Sprintf("Replicas '%v' isn't valid, it must be a number like 3.", args[0]))
+			return errors.New("invalid replicas")
+		}
+		return controlWorkloads(workloadControl{
+			command:  "scale",
+			verb:     fmt.Sprintf("scale to %v replicas", replicas),
+			progress: "Scaling deployment...",
+			failed:   "There was a problem scaling the deployment.",
+			success:  fmt.Sprintf("Successfully scaled deployment to %v replicas.", replicas),
+			mainOnly: true,
+			rollout:  true,
+			apply: func(w web.Workload, cls web.ClusterInfo) error {
+				return web.ScaleWorkload(w, int32(replicas), cls)
+			},
+		}, args[1:])
+	},
+}
+
+// RestartCommand replaces all pods of the workloads running the project.
+var RestartCommand = &cobra.Command{
+	Use:   "restart [service...]",
+	Short: "Restart deployment",
+	Long: `Replace all pods of the workloads running the project with a rolling
+restart, the same way 'kubectl rollout restart' does.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return controlWorkloads(workloadControl{
+			command:  "restart",
+			verb:     "restart",
+			progress: "Restarting deployment...",
+			failed:   "There was a problem restarting the deployment.",
+			success:  "Successfully restarted deployment.",
+			rollout:  true,
+			apply:    web.RestartWorkload,
+		}, args)
+	},
+}
+
+// PauseCommand pauses rollouts of the deployments running the project.
+var PauseCommand = &cobra.Command{
+	Use:   "pause [service...]",
+	Short: "Pause deployment rollouts",
+	Long: `Pause rollouts of the Deployments running the project. Changes made
+while paused, including new deploys, aren't rolled out until resumed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return controlWorkloads(workloadControl{
+			command:  "pause",
+			verb:     "pause",
+			progress: "Pausing deployment...",
+			failed:   "There was a problem pausing the deployment.",
+			success:  "Successfully paused deployment. Run 'kube-cli resume' to continue rollouts.",
+			apply: func(w web.Workload, cls web.ClusterInfo) error {
+				return web.PauseWorkload(w, true, cls)
+			},
+		}, args)
+	},
+}
+
+// ResumeCommand resumes rollouts of the deployments running the project.
+var ResumeCommand = &cobra.Command{
+	Use:   "resume [service...]",
+	Short: "Resume deployment rollouts",
+	Long: `Resume rollouts of paused Deployments running the project and roll out
+the changes made while they were paused.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return controlWorkloads(workloadControl{
+			command:  "resume",
+			verb:     "resume",
+			progress: "Resuming deployment...",
+			failed:   "There was a problem resuming the deployment.",
+			success:  "Successfully resumed deployment.",
+			rollout:  true,
+			apply: func(w web.Workload, cls web.ClusterInfo) error {
+				return web.PauseWorkload(w, false, cls)
+			},
+		}, args)
+	},
+}
+
+// This function is only executed once after the package is imported.
+func init() {
+	for _, cmd := range []*cobra.Command{ScaleCommand, RestartCommand, PauseCommand, ResumeCommand} {
+		cmd.Flags().BoolVarP(&confirmedControl, "yes", "y", false, "don't ask for confirmation on protected clusters")
+		if cmd != PauseCommand {
+			cmd.Flags().BoolVarP(&asyncControl, "async", "a", false, "don't wait for rollout to complete")
+		}
+	}
+}
+
+// workloadControl describes a change of the workloads running services.
+type workloadControl struct {
+	command string
+	// Used in the confirmation prompt, like restart.
+	verb     string
+	progress string
+	failed   string
+	success  string
+	// Only change the main workload of each service.
+	mainOnly bool
+	// Wait for the rollout caused by the change.
+	rollout bool
+	apply   func(w web.Workload, cls web.ClusterInfo) error
+}
+
+// Apply a change to the workloads of the selected services and wait for the rollout.
+func controlWorkloads(ctl workloadControl, args []string) error {
+	spin := ui.ShowSpinner(1, "Reading configuration...")
+	// Get project root directory
+	cwd, err := executable.GetCwd()
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli %v' command.", ctl.command))
+		return err
+	}
+	// Get YAML config path in project root
+	cp, err := config.GetPath(cwd)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't find kubecli YAML file in the project root. Try running 'kube-cli init' to create one.")
+		return err
+	}
+	// Parse project YAML config
+	cfg, err := config.Read(cp)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
+		return err
+	}
+	services, err := selectServices(cfg, args)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
+		return err
+	}
+	ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
+	var names []string
+	for _, svc := range services {
+		names = append(names, svc.Name)
+	}
+	cont, err := confirmProtected(cfg, fmt.Sprintf("%v %v", ctl.verb, strings.Join(names, ", ")))
+	if err != nil {
+		ui.FailMessage("Command canceled by user. No changes made.")
+		return err
+	}
+	if !cont {
+		ui.Message("No changes made.")
+		return nil
+	}
+	spin = ui.ShowSpinner(2, ctl.progress)
+	// Retrieve GKE cluster info
+	cls, err := web.GetGKECluster(cfg.Gke.Project, cfg.Gke.Zone, cfg.Gke.Cluster)
+	if err != nil {
+		ui.SpinnerFail(2, ctl.failed, spin)
+		ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli %v'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.", ctl.command))
+		return err
+	}
+	var targets []web.Workload
+	for _, svc := range services {
+		w, err := serviceWorkloads(cwd, cfg, svc, cls)
+		if err != nil {
+			ui.SpinnerFail(2, ctl.failed, spin)
+			ui.FailMessage(workloadsFailMessage(svc, err))
+			return err
+		}
+		if ctl.mainOnly && len(w) > 1 {
+			w = w[:1]
+		}
+		targets = append(targets, w...)
+	}
+	// Workloads which don't support the change are skipped
+	var workloads []web.Workload
+	var skipped []string
+	for _, w := range targets {
+		err = ctl.apply(w, cls)
+		if e, ok := err.(*web.UnsupportedError); ok {
+			skipped = append(skipped, fmt.Sprintf("%v '%v' can't be %v, it was skipped.", e.Kind, e.Name, e.Operation))
+			continue
+		}
+		if err != nil {
+			ui.SpinnerFail(2, ctl.failed, spin)
+			if e, ok := err.(*web.NotFoundError); ok {
+				ui.FailMessage(fmt.Sprintf("Couldn't find %v '%v' in '%v' namespace in cluster '%v'. Run 'kube-cli deploy' to create it.", e.Kind, e.Name, e.Namespace, cfg.Gke.Cluster))
+				return err
+			}
+			if e, ok := err.(*web.PausedError); ok {
+				ui.FailMessage(pausedFailMessage(e))
+				return err
+			}
+			ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli %v'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.", ctl.command))
+			return err
+		}
+		workloads = append(workloads, w)
+	}
+	if len(workloads) == 0 {
+		ui.SpinnerFail(2, ctl.failed, spin)
+		for _, msg := range skipped {
+			ui.FailMessage(msg)
+		}
+		return fmt.Errorf("no workloads to %v", ctl.command)
+	}
+	if ctl.rollout && !asyncControl {
+		err = waitForRollout(workloads, cls)
+		if err != nil {
+			ui.SpinnerFail(2, ctl.failed, spin)
+			ui.FailMessage(rolloutFailMessage(err))
+			return err
+		}
+	}
+	ui.SpinnerSuccess(2, ctl.success, spin)
+	warnSkipped(skipped)
+	return nil
+}
+
+// Ask for confirmation before changing workloads on a protected cluster.
+func confirmProtected(cfg config.Data, action string) (bool, error) {
+	if !cfg.Gke.Protected || confirmedControl {
+		return true, nil
+	}
+	return ui.Confirm(fmt.Sprintf("Cluster '%v' is protected. Are you sure you want to %v?", cfg.Gke.Cluster, action))
+}
+
+// Describe why a paused Deployment wasn't changed and how to fix it.
+func pausedFailMessage(e *web.PausedError) string {
+	return fmt.Sprintf("Deployment '%v' in '%v' namespace is paused, its rollout wouldn't start. Run 'kube-cli resume' first and rerun the command.", e.Name, e.Namespace)
+}
+
+// Describe why waiting for a rollout failed and how to fix it.
+func rolloutFailMessage(err error) string {
+	if e, ok := err.(*web.PausedError); ok {
+		return pausedFailMessage(e)
+	}
+	if e, ok := err.(*web.ProgressDeadlineError); ok {
+		return fmt.Sprintf("Deployment '%v' in '%v' namespace didn't make progress before its deadline. Check on its pods with 'kube-cli status', fix the issue and rerun the command.", e.Name, e.Namespace)
+	}
+	return "Something unexpected happened. Please check on the status of the rollout with 'kube-cli status'."
+}
+
+// Periodically check workloads until all of them are rolled out.
+func waitForRollout(workloads []web.Workload, cls web.ClusterInfo) error {
+	timeout := 1
+	maxTimeout := 60
+	for {
+		done := true
+		for _, w := range workloads {
+			complete, err := web.RolloutComplete(w, cls)
+			if err != nil {
+				return err
+			}
+			done = done && complete
+		}
+		if done {
+			return nil
+		}
+		timeout *= 2
+		if timeout > maxTimeout {
+			timeout = maxTimeout
+		}
+		time.Sleep(time.Duration(timeout) * time.Second)
+	}
+}
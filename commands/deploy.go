@@ -3,32 +3,42 @@ package commands
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/ajdnik/kube-cli/config"
 	"github.com/ajdnik/kube-cli/executable"
 	"github.com/ajdnik/kube-cli/filesystem"
+	"github.com/ajdnik/kube-cli/hash"
+	"github.com/ajdnik/kube-cli/manifest"
 	"github.com/ajdnik/kube-cli/tar"
 	"github.com/ajdnik/kube-cli/ui"
 	"github.com/ajdnik/kube-cli/web"
-	gitignore "github.com/denormal/go-gitignore"
 	humanize "github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 )
 
+// How long to wait for Helm release resources when release.helm.timeout isn't set.
+const defaultHelmTimeout = 5 * time.Minute
+
 var asyncDeploy bool
+var deployEnv string
 
 // DeployCommand executes a multi step workflow that builds the
 // project using GCP Cloud Build and than deploys the docker image
 // to a GKE deployment.
 var DeployCommand = &cobra.Command{
-	Use:   "deploy",
+	Use:   "deploy [service...]",
 	Short: "Deploy the project to Kubernetes",
 	Long: `Deploy the project to Kubernetes cluster by building a
-Docker image and deploying the image to a Kubernetes Deployment object.`,
+Docker image and deploying the image to a Kubernetes Deployment object.
+
+When kubecli.yaml defines multiple services, the selected services, or all
+of them when none are given, are built and deployed in parallel.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		spin := ui.ShowSpinner(1, "Reading configuration...")
 		// Get project root directory
@@ -52,174 +62,693 @@ Docker image and deploying the image to a Kubernetes Deployment object.`,
 			ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
 			return err
 		}
-		ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
-		spin = ui.ShowSpinner(2, "Packing project into archive...")
-		// Verify Dockerfile exists in project root
-		df := filepath.Join(cwd, "Dockerfile")
-		if !filesystem.FileExists(df) {
-			ui.SpinnerFail(2, "There was a problem packing a project into archive.", spin)
-			ui.FailMessage("Couldn't find Dockerfile in the project root. See https://docs.docker.com/engine/reference/builder/ for further info.")
-			return errors.New("missing Dockerfile")
-		}
-		// Generate project files list
-		pf, err := filesystem.Glob(cwd)
+		services, err := selectServices(cfg, args)
 		if err != nil {
-			ui.SpinnerFail(2, "There was a problem packing a project into archive.", spin)
-			ui.FailMessage("Please, retry 'kube-cli deploy' command as an administrator.")
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
 			return err
 		}
-		// Remove files filtered by .kubecliignore file
-		files, err := filterProjectFiles(pf, cwd)
+		bucket := &stagingBucket{Name: sourceBucket(cfg)}
+		if len(services) == 1 {
+			ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
+			return deployService(cwd, cfg, services[0], bucket, &stepReporter{})
+		}
+		ui.SpinnerSuccess(1, fmt.Sprintf("Successfully read configuration for %v services.", len(services)), spin)
+		// Build and deploy services in parallel on a shared status board
+		names := make([]string, len(services))
+		for i, svc := range services {
+			names[i] = svc.Name
+		}
+		board := ui.ShowStatusBoard(names)
+		reporters := make([]*boardReporter, len(services))
+		errs := make([]error, len(services))
+		var wg sync.WaitGroup
+		for i := range services {
+			reporters[i] = &boardReporter{board: board, task: i}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = deployService(cwd, cfg, services[i], bucket, reporters[i])
+				if errs[i] == nil {
+					board.Success(i, reporters[i].last)
+				}
+			}(i)
+		}
+		wg.Wait()
+		board.Stop()
+		// Print warnings and failure details of each service
+		failed := 0
+		for i, r := range reporters {
+			for _, w := range r.warnings {
+				ui.WarnMessage(fmt.Sprintf("%v: %v", services[i].Name, w))
+			}
+			if errs[i] != nil {
+				failed++
+				ui.FailMessage(fmt.Sprintf("%v: %v", services[i].Name, r.help))
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%v of %v services failed to deploy", failed, len(services))
+		}
+		return nil
+	},
+}
+
+// stagingBucket makes sure the source bucket is checked or created only once
+// when multiple services are deployed in parallel.
+type stagingBucket struct {
+	Name string
+	once sync.Once
+	err  error
+}
+
+// Check the bucket exists and belongs to the project, create it otherwise.
+func (b *stagingBucket) ensure(cfg config.Data) error {
+	b.once.Do(func() {
+		_, b.err = web.EnsureBucket(b.Name, cfg.Gke.Project, web.BucketOptions{
+			Location:      cfg.Build.BucketLocation,
+			KMSKey:        cfg.Build.KMSKey,
+			RetentionDays: cfg.Build.RetentionDays,
+		})
+	})
+	return b.err
+}
+
+// Build the Docker image of a service and deploy it, reporting progress of steps 2 to 5.
+func deployService(cwd string, cfg config.Data, svc config.ServiceData, bucket *stagingBucket, rep serviceReporter) error {
+	rep.Start(2, "Collecting project files...")
+	// Verify Dockerfile exists inside of the build context
+	dir := contextDir(cwd, svc.Docker)
+	if !filesystem.FileExists(dockerfilePath(cwd, svc.Docker)) {
+		rep.Fail(2, "There was a problem collecting project files.", fmt.Sprintf("Couldn't find Dockerfile at %v. See https://docs.docker.com/engine/reference/builder/ for further info.", dockerfilePath(cwd, svc.Docker)))
+		return errors.New("missing Dockerfile")
+	}
+	df, err := contextDockerfile(cwd, svc.Docker)
+	if err != nil {
+		rep.Fail(2, "There was a problem collecting project files.", fmt.Sprintf("Dockerfile %v must be inside of the build context %v. Fix the docker section of kubecli.yaml and rerun the command.", dockerfilePath(cwd, svc.Docker), dir))
+		return err
+	}
+	// Load .kubecliignore and .dockerignore rules
+	ignore, err := newIgnoreMatcher(dir, df)
+	if err != nil {
+		rep.Fail(2, "There was a problem collecting project files.", fmt.Sprintf("Couldn't apply ignore rules from .kubecliignore and .dockerignore files: %v.", err))
+		return err
+	}
+	// Generate project files list without ignored files and directories
+	files, err := filesystem.GlobParallel(dir, ignore.Ignore, runtime.NumCPU())
+	if err != nil {
+		rep.Fail(2, "There was a problem collecting project files.", "Please, retry 'kube-cli deploy' command as an administrator.")
+		return err
+	}
+	// Directories walked only for .dockerignore exceptions are left out when empty
+	files, err = ignore.Prune(files)
+	if err != nil {
+		rep.Fail(2, "There was a problem collecting project files.", "Please, retry 'kube-cli deploy' command as an administrator.")
+		return err
+	}
+	// Summarize project files to warn about large files and secrets before uploading
+	maxSize, err := maxFileSize(cfg)
+	if err != nil {
+		rep.Fail(2, "There was a problem collecting project files.", "Build Max File Size must be a size like '10MB'. Try running 'kube-cli validate' to make sure the file is valid.")
+		return err
+	}
+	report, err := newContextReport(files, dir, maxSize)
+	if err != nil {
+		rep.Fail(2, "There was a problem collecting project files.", "Please, retry 'kube-cli deploy' command as an administrator.")
+		return err
+	}
+	rep.Success(2, fmt.Sprintf("Collected %v project files, %v in total.", report.Files, humanize.Bytes(report.Size)))
+	for _, w := range contextWarnings(report, maxSize) {
+		rep.Warn(w)
+	}
+	rep.StartProgress(3, "Packing and uploading archive...")
+	// Name the archive after the hash of project files so unchanged sources are uploaded only once
+	symlinks := symlinkPolicy(cfg)
+	sum, err := sumProjectFiles(files, dir, symlinks)
+	if err != nil {
+		rep.Fail(3, "There was a problem packing and uploading archive.", archiveFailMessage(err))
+		return err
+	}
+	timestamp := fmt.Sprintf("%v", time.Now().Unix())
+	oName := fmt.Sprintf("%v-%v.tar.gz", svc.Docker.Name, sum)
+	err = bucket.ensure(cfg)
+	if err != nil {
+		rep.Fail(3, "There was a problem packing and uploading archive.", bucketFailMessage(bucket.Name, cfg, err))
+		return err
+	}
+	exists, err := web.ObjectExists(bucket.Name, oName)
+	if err != nil {
+		rep.Fail(3, "There was a problem packing and uploading archive.", "Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Storage Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+		return err
+	}
+	if exists {
+		// Refresh the reused archive so it doesn't expire before archives of older deploys
+		err = web.TouchObject(bucket.Name, oName)
+		if err != nil {
+			rep.Warn(fmt.Sprintf("Couldn't refresh the reused archive %v, 'kube-cli gc' and the bucket retention may delete it before older archives: %v.", oName, err))
+		}
+		rep.Success(3, "Project files haven't changed, reusing uploaded archive.")
+	} else {
+		// Stream .tar.gz archive of project files to GCP Storage
+		sz, err := web.StorageStream(bucket.Name, oName, func(w io.Writer) error {
+			return tar.WriteArchive(files, w, &dir, symlinks)
+		}, rep.Progress)
 		if err != nil {
-			ui.SpinnerFail(2, "There was a problem packing a project into archive.", spin)
-			ui.FailMessage("Please, retry 'kube-cli deploy' command as an administrator.")
+			if isArchiveError(err) {
+				rep.Fail(3, "There was a problem packing and uploading archive.", archiveFailMessage(err))
+				return err
+			}
+			rep.Fail(3, "There was a problem packing and uploading archive.", "Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Storage Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
 			return err
 		}
-		// Create temp file for project archive
-		tmp, err := filesystem.CreateTemp()
+		rep.Success(3, fmt.Sprintf("Uploaded archive %s.", humanize.Bytes(uint64(sz))))
+	}
+	rep.Start(4, "Building project...")
+	// Create build on GCP Cloud Build
+	tags := []string{
+		svc.Docker.Tag,
+		timestamp,
+	}
+	bld, err := web.CreateBuild(cfg.Gke.Project, svc.Docker.Name, bucket.Name, oName, df, tags)
+	if err != nil {
+		rep.Fail(4, "There was a problem building the project.", "Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Cloud Build Service Account' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+		return err
+	}
+	// Periodically check on build status
+	running := true
+	timeout := 1
+	maxTimeout := 60
+	for running {
+		b, err := web.GetBuild(cfg.Gke.Project, bld.ID)
 		if err != nil {
-			ui.SpinnerFail(2, "There was a problem packing a project into archive.", spin)
-			ui.FailMessage("Please, retry 'kube-cli deploy' command as an administrator.")
+			rep.Fail(4, "There was a problem building the project.", "Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Cloud Build Service Account' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
 			return err
 		}
-		defer os.Remove(tmp)
-		// Create .tar.gz archive from project files
-		err = tar.Archive(files, tmp, &cwd)
+		// The build succeeded
+		if b.Status == web.SuccessBuildStatus {
+			running = false
+			break
+		}
+		// The build is still running or waiting to be run
+		if b.Status == web.QueuedBuildStatus || b.Status == web.WorkingBuildStatus {
+			timeout *= 2
+			if timeout > maxTimeout {
+				timeout = maxTimeout
+			}
+			time.Sleep(time.Duration(timeout) * time.Second)
+			continue
+		}
+		// The build failed
+		rep.Fail(4, "There was a problem building the project.", fmt.Sprintf("There was a problem building the project, fix the issue and rerun the command. More info available at %v.", b.LogURL))
+		return fmt.Errorf("visit %v to learn more", b.LogURL)
+	}
+	rep.Success(4, "Building project succeeded.")
+	rep.Start(5, "Deploying project...")
+	// Retrieve GKE cluster info
+	cls, err := web.GetGKECluster(cfg.Gke.Project, cfg.Gke.Zone, cfg.Gke.Cluster)
+	if err != nil {
+		rep.Fail(5, "There was a problem deploying the project.", "Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+		return err
+	}
+	if hasEnv(svc) {
+		// Sync the env section before workloads load it
+		for _, ns := range envNamespaces(svc) {
+			_, err = web.SyncConfigMap(envConfigMapName(svc), ns, svc.Env, cls)
+			if err != nil {
+				rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("Couldn't update ConfigMap '%v' in '%v' namespace: %v. Please, retry 'kube-cli deploy'.", envConfigMapName(svc), ns, err))
+				return err
+			}
+		}
+	}
+	secretsChecksum := ""
+	if hasSecrets(svc) {
+		// Load the Secret Manager secrets into a Secret before workloads load it
+		data, versions, err := accessSecrets(cfg, svc)
 		if err != nil {
-			ui.SpinnerFail(2, "There was a problem packing a project into archive.", spin)
-			ui.FailMessage("Please, retry 'kube-cli deploy' command as an administrator.")
+			rep.Fail(5, "There was a problem deploying the project.", secretsFailMessage(err))
 			return err
 		}
-		ui.SpinnerSuccess(2, "Project packing successfull.", spin)
-		spin = ui.ShowSpinner(3, "Uploading archive...")
-		// Upload .tar.gz archive to GCP Storage
-		bName := cfg.Gke.Project + "-cloudbuild"
-		timestamp := fmt.Sprintf("%v", time.Now().Unix())
-		oName := fmt.Sprintf("%v-%v.tar.gz", cfg.Docker.Name, timestamp)
-		_ = web.CreateBucket(bName, cfg.Gke.Project)
-		sz, err := web.StorageUpload(bName, oName, tmp)
+		secretsChecksum = hash.SumValues(versions)
+		for _, ns := range envNamespaces(svc) {
+			_, err = web.SyncSecret(envSecretName(svc), ns, data, cls)
+			if err != nil {
+				rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("Couldn't update Secret '%v' in '%v' namespace: %v. Please, retry 'kube-cli deploy'.", envSecretName(svc), ns, err))
+				return err
+			}
+		}
+	}
+	di := fmt.Sprintf("gcr.io/%v/%v:%v", cfg.Gke.Project, svc.Docker.Name, timestamp)
+	main, err := hookWorkload(cwd, cfg, svc, cls)
+	if err != nil {
+		rep.Fail(5, "There was a problem deploying the project.", workloadsFailMessage(svc, err))
+		return err
+	}
+	// Pre-deploy hooks like migrations must succeed before anything is rolled out
+	err = runHooks(svc, svc.Hooks.PreDeploy, di, timestamp, main, cls, rep)
+	if err != nil {
+		rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("%v Workloads weren't updated.", hookFailMessage(err)))
+		return err
+	}
+	warnAsyncHooks(svc, rep)
+	if hasHelmRelease(svc) {
+		// Install or upgrade the Helm release with the built image
+		rel, err := helmRelease(cwd, cfg, svc, deployEnv, timestamp, secretsChecksum)
 		if err != nil {
-			ui.SpinnerFail(3, "There was a problem uploading archive.", spin)
-			ui.FailMessage("Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Storage Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+			rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("Couldn't configure the Helm release, %v. Fix the release section of kubecli.yaml and rerun the command.", err))
 			return err
 		}
-		ui.SpinnerSuccess(3, fmt.Sprintf("Uploaded archive %s.", humanize.Bytes(uint64(sz))), spin)
-		spin = ui.ShowSpinner(4, "Building project...")
-		// Create build on GCP Cloud Build
-		tags := []string{
-			cfg.Docker.Tag,
-			timestamp,
+		if asyncDeploy {
+			rel.Wait = 0
 		}
-		bld, err := web.CreateBuild(cfg.Gke.Project, cfg.Docker.Name, bName, oName, tags)
+		rev, err := web.UpgradeRelease(rel, cls)
 		if err != nil {
-			ui.SpinnerFail(4, "There was a problem building the project.", spin)
-			ui.FailMessage("Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Cloud Build Service Account' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+			rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("Couldn't install or upgrade Helm release '%v': %v. Fix the chart or its values and rerun the command.", rel.Name, err))
 			return err
 		}
-		// Periodically check on build status
-		running := true
-		timeout := 1
-		maxTimeout := 60
-		for running {
-			b, err := web.GetBuild(cfg.Gke.Project, bld.ID)
+		if !asyncDeploy {
+			err = postDeploy(svc, di, timestamp, main, nil, cls, rep)
 			if err != nil {
-				ui.SpinnerFail(4, "There was a problem building the project.", spin)
-				ui.FailMessage("Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Cloud Build Service Account' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
 				return err
 			}
-			// The build succeeded
-			if b.Status == web.SuccessBuildStatus {
-				running = false
-				break
-			}
-			// The build is still running or waiting to be run
-			if b.Status == web.QueuedBuildStatus || b.Status == web.WorkingBuildStatus {
-				timeout *= 2
-				if timeout > maxTimeout {
-					timeout = maxTimeout
-				}
-				time.Sleep(time.Duration(timeout) * time.Second)
-				continue
-			}
-			// The build failed
-			ui.SpinnerFail(4, "There was a problem building the project.", spin)
-			ui.FailMessage(fmt.Sprintf("There was a problem building the project, fix the issue and rerun the command. More info available at %v.", b.LogURL))
-			return fmt.Errorf("visit %v to learn more", b.LogURL)
-		}
-		ui.SpinnerSuccess(4, "Building project succeeded.", spin)
-		spin = ui.ShowSpinner(5, "Deploying project...")
-		// Retrieve GKE cluster info
-		cls, err := web.GetGKECluster(cfg.Gke.Project, cfg.Gke.Zone, cfg.Gke.Cluster)
+		}
+		rep.Success(5, fmt.Sprintf("Deployed revision %v of Helm release '%v'.", rev, rel.Name))
+		return nil
+	}
+	var workloads []web.Workload
+	if hasManifests(svc) {
+		// Render manifests with the built image and apply them to the cluster
+		workloads, err = applyManifests(cwd, cfg, svc, di, timestamp, secretsChecksum, cls)
 		if err != nil {
-			ui.SpinnerFail(5, "There was a problem deploying the project.", spin)
-			ui.FailMessage("Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+			rep.Fail(5, "There was a problem deploying the project.", manifestFailMessage(err))
 			return err
 		}
-		// Update GKE deployment image
-		di := fmt.Sprintf("gcr.io/%v/%v:%v", cfg.Gke.Project, cfg.Docker.Name, timestamp)
-		err = web.UpdateDeployment(cfg.Deployment.Namespace, cfg.Deployment.Name, cfg.Deployment.Container.Name, di, cls)
+	} else {
+		// Update the image of all target workloads together
+		workloads = withEnv(svc, secretsChecksum, targetWorkloads(svc.Deployment))
+		err = web.UpdateWorkloads(workloads, di, cls)
 		if err != nil {
-			ui.SpinnerFail(5, "There was a problem deploying the project.", spin)
-			if err.Error() == fmt.Sprintf("deployments.apps \"%v\" not found", cfg.Deployment.Name) {
-				ui.FailMessage(fmt.Sprintf("Couldn't find deployment '%v' in '%v' namespace in cluster '%v'. Make sure you've created a deployment beforehand and rerun the command.", cfg.Deployment.Name, cfg.Deployment.Namespace, cfg.Gke.Cluster))
+			switch e := err.(type) {
+			case *web.NotFoundError:
+				rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("Couldn't find %v '%v' in '%v' namespace in cluster '%v'. Make sure you've created it beforehand and rerun the command.", e.Kind, e.Name, e.Namespace, cfg.Gke.Cluster))
+				return err
+			case *web.ContainerNotFoundError:
+				rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("Couldn't find container '%v' in %v '%v'. Fix the containers in the deployment section of kubecli.yaml and rerun the command.", e.Container, e.Kind, e.Workload))
 				return err
 			}
-			ui.FailMessage("Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+			rep.Fail(5, "There was a problem deploying the project.", "Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
 			return err
 		}
-		if asyncDeploy {
-			ui.SpinnerSuccess(5, "Successfully started the rolling deployment. You can keep track of the progress at https://console.cloud.google.com/kubernetes/workload.", spin)
-			return nil
-		}
-		// Periodically check deployment
-		running = true
-		timeout = 1
-		for running {
-			cnt, err := web.UnavailableReplicas(cfg.Deployment.Namespace, cfg.Deployment.Name, cls)
+	}
+	if asyncDeploy {
+		rep.Success(5, "Successfully started the rolling deployment. You can keep track of the progress at https://console.cloud.google.com/kubernetes/workload.")
+		return nil
+	}
+	// Periodically check workloads until all of them are rolled out
+	waiting := workloads
+	paused := false
+	timeout = 1
+	for {
+		var pending []web.Workload
+		for _, w := range waiting {
+			complete, err := web.RolloutComplete(w, cls)
+			if e, ok := err.(*web.PausedError); ok {
+				// Paused Deployments only roll out the new version once they're resumed
+				rep.Warn(fmt.Sprintf("Deployment '%v' in '%v' namespace is paused, the new version rolls out once 'kube-cli resume' is run.", e.Name, e.Namespace))
+				paused = true
+				continue
+			}
 			if err != nil {
-				ui.SpinnerFail(5, "There was a problem deploying the project.", spin)
-				ui.FailMessage("Something unexpected happened. Please check on the status of the deployment on the Google Cloud Console https://console.cloud.google.com/kubernetes/workload.")
+				if e, ok := err.(*web.JobFailedError); ok {
+					rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("Job '%v' in '%v' namespace failed. Check its logs on the Google Cloud Console https://console.cloud.google.com/kubernetes/workload, fix the issue and rerun the command.", e.Name, e.Namespace))
+					return err
+				}
+				if _, ok := err.(*web.ProgressDeadlineError); ok {
+					rep.Fail(5, "There was a problem deploying the project.", rolloutFailMessage(err))
+					return err
+				}
+				rep.Fail(5, "There was a problem deploying the project.", "Something unexpected happened. Please check on the status of the deployment on the Google Cloud Console https://console.cloud.google.com/kubernetes/workload.")
 				return err
 			}
-			if cnt == 0 {
-				running = false
-				break
-			}
-			timeout *= 2
-			if timeout > maxTimeout {
-				timeout = maxTimeout
+			if !complete {
+				pending = append(pending, w)
 			}
-			time.Sleep(time.Duration(timeout) * time.Second)
 		}
-		ui.SpinnerSuccess(5, "Deploying project succeeded.", spin)
+		waiting = pending
+		if len(waiting) == 0 {
+			break
+		}
+		timeout *= 2
+		if timeout > maxTimeout {
+			timeout = maxTimeout
+		}
+		time.Sleep(time.Duration(timeout) * time.Second)
+	}
+	if paused {
+		if len(svc.Hooks.PostDeploy) > 0 {
+			rep.Warn("Post-deploy hooks weren't run, they run once the rollout completes and paused Deployments don't roll out until they're resumed.")
+		}
+		rep.Success(5, "Deployed the project, paused Deployments roll it out once they're resumed.")
 		return nil
-	},
+	}
+	err = postDeploy(svc, di, timestamp, main, workloads, cls, rep)
+	if err != nil {
+		return err
+	}
+	rep.Success(5, "Deploying project succeeded.")
+	return nil
 }
 
 // This function is only executed once after the package is imported.
 func init() {
 	DeployCommand.Flags().BoolVarP(&asyncDeploy, "async", "a", false, "don't wait for deploy operation to complete")
+	DeployCommand.Flags().StringVarP(&deployEnv, "env", "e", "", "environment whose Helm values files are used")
+}
+
+// Convert deployment targets into workloads whose containers run the deployed image.
+func targetWorkloads(dpl config.DeploymentData) []web.Workload {
+	var workloads []web.Workload
+	for _, t := range dpl.AllTargets() {
+		w := web.Workload{
+			Kind:      t.Kind,
+			Namespace: t.Namespace,
+			Name:      t.Name,
+		}
+		if len(w.Kind) == 0 {
+			w.Kind = web.DeploymentKind
+		}
+		for _, c := range t.Containers {
+			if c.Init {
+				w.InitContainers = append(w.InitContainers, c.Name)
+			} else {
+				w.Containers = append(w.Containers, c.Name)
+			}
+		}
+		workloads = append(workloads, w)
+	}
+	return workloads
+}
+
+// Namespace of manifest objects which don't set one.
+func manifestNamespace(svc config.ServiceData) string {
+	if len(svc.Manifests.Namespace) > 0 {
+		return svc.Manifests.Namespace
+	}
+	if len(svc.Deployment.Namespace) > 0 {
+		return svc.Deployment.Namespace
+	}
+	return "default"
 }
 
-// Filter files based on rules defined in .kubecliignore file.
-func filterProjectFiles(files []string, cwd string) ([]string, error) {
-	ip := filepath.Join(cwd, ".kubecliignore")
-	ignore := gitignore.New(strings.NewReader(".git/**/*\n.kubecliignore"), cwd, nil)
-	var err error
-	// Load .kubecliignore if it exists
-	if filesystem.FileExists(ip) {
-		ignore, err = gitignore.NewFromFile(ip)
+// Check if a service is deployed by applying manifests instead of updating workload images.
+func hasManifests(svc config.ServiceData) bool {
+	return len(svc.Manifests.Dir) > 0 || len(svc.Manifests.Kustomize) > 0
+}
+
+// Render the manifests of a service with the given image, images are left
+// as they are when the tag is empty.
+func renderManifests(cwd string, cfg config.Data, svc config.ServiceData, image, tag, secretsChecksum string) ([]manifest.Document, error) {
+	if len(svc.Manifests.Kustomize) > 0 {
+		// Like the images field of a kustomization, the image can be referenced by its name
+		var images []manifest.Image
+		if len(tag) > 0 {
+			repo := fmt.Sprintf("gcr.io/%v/%v", cfg.Gke.Project, svc.Docker.Name)
+			images = []manifest.Image{
+				{Name: svc.Docker.Name, NewName: repo, NewTag: tag},
+				{Name: repo, NewTag: tag},
+			}
+		}
+		return manifest.Kustomize(filepath.Join(cwd, svc.Manifests.Kustomize), images)
+	}
+	return manifest.Render(filepath.Join(cwd, svc.Manifests.Dir), manifest.Data{
+		Image:     image,
+		Tag:       tag,
+		Service:   svc.Name,
+		Project:   cfg.Gke.Project,
+		Namespace: manifestNamespace(svc),
+		Values:    svc.Manifests.Values,
+		// Manifests load the ConfigMap themselves, the checksum rolls them out on changes
+		EnvConfigMap:    envConfigMap(svc),
+		EnvChecksum:     envChecksum(svc),
+		EnvSecret:       envSecret(svc),
+		SecretsChecksum: secretsChecksum,
+	})
+}
+
+// Apply the manifests of a service with the built image and return the applied workloads.
+func applyManifests(cwd string, cfg config.Data, svc config.ServiceData, image, tag, secretsChecksum string, cls web.ClusterInfo) ([]web.Workload, error) {
+	docs, err := renderManifests(cwd, cfg, svc, image, tag, secretsChecksum)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := web.ApplyManifests(docs, manifestNamespace(svc), cls)
+	if err != nil {
+		return nil, err
+	}
+	var workloads []web.Workload
+	for _, obj := range applied {
+		if linearSearch(obj.Kind, web.WorkloadKinds) {
+			workloads = append(workloads, web.Workload{Kind: obj.Kind, Namespace: obj.Namespace, Name: obj.Name})
+		}
+	}
+	return workloads, nil
+}
+
+// Workloads defined by the manifests of a service.
+func manifestWorkloads(cwd string, cfg config.Data, svc config.ServiceData) ([]web.Workload, error) {
+	docs, err := renderManifests(cwd, cfg, svc, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	return documentWorkloads(docs, manifestNamespace(svc))
+}
+
+// Workloads defined by YAML documents, namespace is used for documents without one.
+func documentWorkloads(docs []manifest.Document, namespace string) ([]web.Workload, error) {
+	var workloads []web.Workload
+	for _, d := range docs {
+		h, err := d.Header()
 		if err != nil {
-			return files, err
+			return nil, &web.ManifestError{File: d.File, Err: err}
+		}
+		if !linearSearch(h.Kind, web.WorkloadKinds) {
+			continue
 		}
+		ns := h.Metadata.Namespace
+		if len(ns) == 0 {
+			ns = namespace
+		}
+		workloads = append(workloads, web.Workload{Kind: h.Kind, Namespace: ns, Name: h.Metadata.Name})
+	}
+	return workloads, nil
+}
+
+// Describe why manifests couldn't be applied and how to fix it.
+func manifestFailMessage(err error) string {
+	switch e := err.(type) {
+	case *manifest.TemplateError:
+		return fmt.Sprintf("Couldn't render manifest %v: %v. Fix the template and rerun the command.", e.File, e.Err)
+	case *web.ManifestError:
+		return fmt.Sprintf("Couldn't apply manifest %v: %v. Fix the manifest and rerun the command.", e.File, e.Err)
+	}
+	return "Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS."
+}
+
+// Check if a service is deployed by installing a Helm release.
+func hasHelmRelease(svc config.ServiceData) bool {
+	return len(svc.Release.Helm.Chart) > 0
+}
+
+// Name of the Helm release of a service.
+func helmReleaseName(svc config.ServiceData) string {
+	if len(svc.Release.Helm.Name) > 0 {
+		return svc.Release.Helm.Name
+	}
+	return svc.Name
+}
+
+// Namespace of the Helm release of a service.
+func helmNamespace(svc config.ServiceData) string {
+	if len(svc.Release.Helm.Namespace) > 0 {
+		return svc.Release.Helm.Namespace
+	}
+	if len(svc.Deployment.Namespace) > 0 {
+		return svc.Deployment.Namespace
+	}
+	return "default"
+}
+
+// Parse how long to wait for Helm release resources to be ready.
+func helmTimeout(svc config.ServiceData) (time.Duration, error) {
+	if len(svc.Release.Helm.Timeout) == 0 {
+		return defaultHelmTimeout, nil
+	}
+	return time.ParseDuration(svc.Release.Helm.Timeout)
+}
+
+// Describe the Helm release of a service with values files of an environment,
+// the image values set to the built image and the env ConfigMap and Secret
+// values. Image values aren't set when the tag is empty.
+func helmRelease(cwd string, cfg config.Data, svc config.ServiceData, env, tag, secretsChecksum string) (web.HelmRelease, error) {
+	helm := svc.Release.Helm
+	rel := web.HelmRelease{
+		Name:      helmReleaseName(svc),
+		Namespace: helmNamespace(svc),
+		Chart:     filepath.Join(cwd, helm.Chart),
+		Values:    make(map[string]string),
+	}
+	wait, err := helmTimeout(svc)
+	if err != nil {
+		return rel, fmt.Errorf("timeout %v isn't a duration like 5m", helm.Timeout)
+	}
+	rel.Wait = wait
+	files := helm.Values
+	if len(env) > 0 {
+		envFiles, ok := helm.Environments[env]
+		if !ok {
+			return rel, fmt.Errorf("environment '%v' isn't defined", env)
+		}
+		files = append(files[:len(files):len(files)], envFiles...)
 	}
-	// Keep files that aren(t filtered by ignore rules
-	i := 0
 	for _, f := range files {
-		if ignore.Include(f) {
-			files[i] = f
-			i++
+		rel.ValuesFiles = append(rel.ValuesFiles, filepath.Join(cwd, f))
+	}
+	if len(tag) > 0 {
+		repoKey, tagKey := helm.ImageRepository, helm.ImageTag
+		if len(repoKey) == 0 {
+			repoKey = "image.repository"
+		}
+		if len(tagKey) == 0 {
+			tagKey = "image.tag"
+		}
+		rel.Values[repoKey] = fmt.Sprintf("gcr.io/%v/%v", cfg.Gke.Project, svc.Docker.Name)
+		rel.Values[tagKey] = tag
+	}
+	if hasEnv(svc) {
+		// Charts load the env ConfigMap themselves, the checksum rolls them out on changes
+		rel.Values["kubecli.envConfigMap"] = envConfigMapName(svc)
+		rel.Values["kubecli.envChecksum"] = envChecksum(svc)
+	}
+	if hasSecrets(svc) {
+		rel.Values["kubecli.envSecret"] = envSecretName(svc)
+		rel.Values["kubecli.secretsChecksum"] = secretsChecksum
+	}
+	return rel, nil
+}
+
+// Name of the Google Storage bucket where source archives are uploaded.
+func sourceBucket(cfg config.Data) string {
+	if len(cfg.Build.Bucket) > 0 {
+		return cfg.Build.Bucket
+	}
+	return cfg.Gke.Project + "-cloudbuild"
+}
+
+// Describe why the source bucket couldn't be used and how to fix it.
+func bucketFailMessage(bucket string, cfg config.Data, err error) string {
+	switch err {
+	case web.ErrBucketNotOwned:
+		return fmt.Sprintf("Bucket '%v' already exists and doesn't belong to GCP project '%v'. Bucket names are global, set a different 'bucket' in the build section of kubecli.yaml.", bucket, cfg.Gke.Project)
+	case web.ErrBucketForbidden:
+		return fmt.Sprintf("Access to bucket '%v' was denied. Make sure the GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS has 'Storage Admin' permissions in GCP project '%v'.", bucket, cfg.Gke.Project)
+	}
+	if len(cfg.Build.KMSKey) > 0 {
+		return fmt.Sprintf("Couldn't create bucket '%v': %v. Make sure the Cloud Storage service account has 'Cloud KMS CryptoKey Encrypter/Decrypter' permissions on key '%v'.", bucket, err, cfg.Build.KMSKey)
+	}
+	return fmt.Sprintf("Couldn't access bucket '%v': %v. Please, retry 'kube-cli deploy' and make sure you have an active internet connection.", bucket, err)
+}
+
+// Compute a hash of the deterministic tar stream of project files.
+func sumProjectFiles(files []string, dir string, symlinks tar.SymlinkPolicy) (string, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(tar.Write(files, pw, &dir, symlinks))
+	}()
+	return hash.SumReader(pr)
+}
+
+// Convert the symlinks build option into an archive symlink policy.
+func symlinkPolicy(cfg config.Data) tar.SymlinkPolicy {
+	switch cfg.Build.Symlinks {
+	case "copy":
+		return tar.CopySymlinks
+	case "reject":
+		return tar.RejectSymlinks
+	default:
+		return tar.KeepSymlinks
+	}
+}
+
+// Check if an error was caused by reading project files while packing the archive.
+func isArchiveError(err error) bool {
+	switch err.(type) {
+	case *os.PathError, *os.LinkError, *tar.SymlinkError, *tar.UnsupportedFileError:
+		return true
+	}
+	return false
+}
+
+// Describe why project files couldn't be packed into the archive and how to fix it.
+func archiveFailMessage(err error) string {
+	switch e := err.(type) {
+	case *tar.SymlinkError:
+		return fmt.Sprintf("Symlink %v points outside of the project to %v. Add it to .kubecliignore or set 'symlinks' in the build section of kubecli.yaml to 'keep' or 'copy'.", e.Path, e.Target)
+	case *tar.UnsupportedFileError:
+		return fmt.Sprintf("Couldn't pack %v, sockets, devices and named pipes can't be uploaded. Add it to .kubecliignore and rerun the command.", e.Path)
+	}
+	return "Couldn't read project files while packing the archive. Please, retry 'kube-cli deploy' command as an administrator."
+}
+
+// Check if a service defines environment variables in the env section.
+func hasEnv(svc config.ServiceData) bool {
+	return len(svc.Env) > 0
+}
+
+// Name of the ConfigMap with the env section of a service.
+func envConfigMapName(svc config.ServiceData) string {
+	return fmt.Sprintf("%v-env", svc.Name)
+}
+
+// Name of the env ConfigMap of a service, empty when the service doesn't have one.
+func envConfigMap(svc config.ServiceData) string {
+	if !hasEnv(svc) {
+		return ""
+	}
+	return envConfigMapName(svc)
+}
+
+// Checksum of the env section of a service, empty when the service doesn't have one.
+func envChecksum(svc config.ServiceData) string {
+	if !hasEnv(svc) {
+		return ""
+	}
+	return hash.SumValues(svc.Env)
+}
+
+// Namespaces where the env ConfigMap of a service is created, the same as its workloads.
+func envNamespaces(svc config.ServiceData) []string {
+	if hasHelmRelease(svc) {
+		return []string{helmNamespace(svc)}
+	}
+	if hasManifests(svc) {
+		return []string{manifestNamespace(svc)}
+	}
+	var namespaces []string
+	for _, w := range targetWorkloads(svc.Deployment) {
+		if !linearSearch(w.Namespace, namespaces) {
+			namespaces = append(namespaces, w.Namespace)
 		}
 	}
-	return files[:i], nil
+	return namespaces
+}
+
+// Load the env ConfigMap and Secret of a service into its target workloads,
+// secretsChecksum is the checksum of the loaded secret versions.
+func withEnv(svc config.ServiceData, secretsChecksum string, workloads []web.Workload) []web.Workload {
+	for i := range workloads {
+		workloads[i].EnvConfigMap = envConfigMap(svc)
+		workloads[i].EnvChecksum = envChecksum(svc)
+		workloads[i].EnvSecret = envSecret(svc)
+		workloads[i].SecretsChecksum = secretsChecksum
+	}
+	return workloads
 }
@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/executable"
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+)
+
+var diffTag string
+var diffEnv string
+
+// Returned by diff when the cluster differs from the desired state.
+var errChangesFound = errors.New("changes found")
+
+// DiffCommand compares the state deploy would create with the live cluster.
+var DiffCommand = &cobra.Command{
+	Use:   "diff [service...]",
+	Short: "Show changes a deploy would make",
+	Long: `Compare the live cluster with the state a deploy would create and print
+the differences as a unified diff. The desired state is computed by the cluster
+with a server-side dry-run, so nothing is changed. Like kubectl diff, the command
+exits with code 1 when there are changes and with code 2 when it fails.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := diffServices(args)
+		if err != nil && err != errChangesFound {
+			return &ExitError{Code: 2, Err: err}
+		}
+		return err
+	},
+}
+
+// This function is only executed once after the package is imported.
+func init() {
+	DiffCommand.Flags().StringVarP(&diffTag, "tag", "t", "", "docker tag of the desired image, defaults to the tag in kubecli.yaml")
+	DiffCommand.Flags().StringVarP(&diffEnv, "env", "e", "", "environment whose Helm values files are used")
+	// Invalid flags are failures too, so they don't look like found changes
+	DiffCommand.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		ui.FailMessage(fmt.Sprintf("Invalid flags, %v. Run 'kube-cli diff --help' to see the available flags.", err))
+		return &ExitError{Code: 2, Err: err}
+	})
+}
+
+// Compare the selected services with the cluster and print the differences,
+// errChangesFound is returned when there are any.
+func diffServices(args []string) error {
+	spin := ui.ShowSpinner(1, "Reading configuration...")
+	// Get project root directory
+	cwd, err := executable.GetCwd()
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Please, retry 'kube-cli diff' command.")
+		return err
+	}
+	// Get YAML config path in project root
+	cp, err := config.GetPath(cwd)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't find kubecli YAML file in the project root. Try running 'kube-cli init' to create one.")
+		return err
+	}
+	// Parse project YAML config
+	cfg, err := config.Read(cp)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
+		return err
+	}
+	services, err := selectServices(cfg, args)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
+		return err
+	}
+	ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
+	spin = ui.ShowSpinner(2, "Comparing with the cluster...")
+	// Retrieve GKE cluster info
+	cls, err := web.GetGKECluster(cfg.Gke.Project, cfg.Gke.Zone, cfg.Gke.Cluster)
+	if err != nil {
+		ui.SpinnerFail(2, "There was a problem comparing with the cluster.", spin)
+		ui.FailMessage("Please, retry 'kube-cli diff'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+		return err
+	}
+	var diffs []web.ObjectDiff
+	for _, svc := range services {
+		d, err := diffService(cwd, cfg, svc, cls)
+		if err != nil {
+			ui.SpinnerFail(2, "There was a problem comparing with the cluster.", spin)
+			ui.FailMessage(diffFailMessage(cfg, svc, err))
+			return err
+		}
+		diffs = append(diffs, d...)
+	}
+	ui.SpinnerSuccess(2, "Successfully compared with the cluster.", spin)
+	changed := 0
+	for _, d := range diffs {
+		text, err := unifiedDiff(d)
+		if err != nil {
+			ui.FailMessage(fmt.Sprintf("Couldn't compare %v '%v': %v.", d.Kind, d.Name, err))
+			return err
+		}
+		if len(text) == 0 {
+			continue
+		}
+		changed++
+		ui.Diff(text)
+	}
+	if changed == 0 {
+		ui.SuccessMessage("The cluster is up to date, there are no changes.")
+		return nil
+	}
+	ui.WarnMessage(fmt.Sprintf("%v of %v objects differ from the cluster.", changed, len(diffs)))
+	return errChangesFound
+}
+
+// Compare the state a deploy of a service would create with the cluster.
+func diffService(cwd string, cfg config.Data, svc config.ServiceData, cls web.ClusterInfo) ([]web.ObjectDiff, error) {
+	tag := diffTag
+	if len(tag) == 0 {
+		tag = svc.Docker.Tag
+	}
+	secretsChecksum, err := secretVersionsChecksum(cfg, svc)
+	if err != nil {
+		return nil, err
+	}
+	if hasHelmRelease(svc) {
+		rel, err := helmRelease(cwd, cfg, svc, diffEnv, tag, secretsChecksum)
+		if err != nil {
+			return nil, err
+		}
+		docs, err := web.RenderRelease(rel, cls)
+		if err != nil {
+			return nil, err
+		}
+		return web.DiffManifests(docs, rel.Namespace, cls)
+	}
+	di := fmt.Sprintf("gcr.io/%v/%v:%v", cfg.Gke.Project, svc.Docker.Name, tag)
+	if hasManifests(svc) {
+		docs, err := renderManifests(cwd, cfg, svc, di, tag, secretsChecksum)
+		if err != nil {
+			return nil, err
+		}
+		return web.DiffManifests(docs, manifestNamespace(svc), cls)
+	}
+	return web.DiffWorkloads(withEnv(svc, secretsChecksum, targetWorkloads(svc.Deployment)), di, cls)
+}
+
+// Build a unified diff of an object, it's empty when there are no changes.
+func unifiedDiff(d web.ObjectDiff) (string, error) {
+	name := path.Join(d.Kind, d.Namespace, d.Name)
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(d.Live)),
+		B:        difflib.SplitLines(string(d.Desired)),
+		FromFile: path.Join("live", name),
+		ToFile:   path.Join("desired", name),
+		Context:  3,
+	})
+}
+
+// Describe why a service couldn't be compared with the cluster and how to fix it.
+func diffFailMessage(cfg config.Data, svc config.ServiceData, err error) string {
+	switch e := err.(type) {
+	case *web.NotFoundError:
+		return fmt.Sprintf("Couldn't find %v '%v' in '%v' namespace in cluster '%v'. Make sure you've created it beforehand and rerun the command.", e.Kind, e.Name, e.Namespace, cfg.Gke.Cluster)
+	case *web.ContainerNotFoundError:
+		return fmt.Sprintf("Couldn't find container '%v' in %v '%v'. Fix the containers in the deployment section of kubecli.yaml and rerun the command.", e.Container, e.Kind, e.Workload)
+	case *web.SecretNotFoundError:
+		return secretsFailMessage(err)
+	}
+	if hasHelmRelease(svc) {
+		return fmt.Sprintf("Couldn't render Helm release '%v': %v. Fix the release section of kubecli.yaml or the chart and rerun the command.", helmReleaseName(svc), err)
+	}
+	if hasManifests(svc) {
+		return manifestFailMessage(err)
+	}
+	return "Please, retry 'kube-cli diff'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS."
+}
@@ -0,0 +1,230 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/executable"
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
+	"github.com/spf13/cobra"
+)
+
+var envService string
+var envContainer string
+
+// EnvCommand groups commands managing environment variables of the deployed container.
+var EnvCommand = &cobra.Command{
+	Use:   "env",
+	Short: "Manage environment variables",
+	Long: `List, set and unset environment variables of the container running the
+project, without building and deploying it again. Variables defined in the env
+section of kubecli.yaml are synced to a ConfigMap on deploy instead.`,
+}
+
+// EnvListCommand lists environment variables of the deployed container.
+var EnvListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List environment variables",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, _, cls, w, container, err := envTarget("list")
+		if err != nil {
+			return err
+		}
+		vars, sources, err := web.ContainerEnv(w, container, cls)
+		if err != nil {
+			ui.FailMessage(envFailMessage("list", err))
+			return err
+		}
+		if len(vars) == 0 && len(sources) == 0 {
+			ui.Message("The container doesn't have any environment variables.")
+			return nil
+		}
+		for _, v := range vars {
+			if len(v.From) > 0 {
+				ui.Message(fmt.Sprintf("%v (from %v)", v.Name, v.From))
+				continue
+			}
+			ui.Message(fmt.Sprintf("%v=%v", v.Name, v.Value))
+		}
+		for _, s := range sources {
+			ui.Message(fmt.Sprintf("Variables loaded from %v.", s))
+		}
+		return nil
+	},
+}
+
+// EnvSetCommand sets environment variables of the deployed container.
+var EnvSetCommand = &cobra.Command{
+	Use:   "set KEY=VALUE...",
+	Short: "Set environment variables",
+	Long: `Set environment variables of the container running the project and roll
+out the change.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		set := make(map[string]string)
+		for _, arg := range args {
+			parts := strings.SplitN(arg, "=", 2)
+			if len(parts) != 2 || !validEnvName.MatchString(parts[0]) {
+				ui.FailMessage(fmt.Sprintf("Argument '%v' isn't valid, give variables as KEY=VALUE where KEY consists of letters, digits and underscores.", arg))
+				return errors.New("invalid environment variable")
+			}
+			set[parts[0]] = parts[1]
+		}
+		return changeEnv("set", set, nil)
+	},
+}
+
+// EnvUnsetCommand removes environment variables of the deployed container.
+var EnvUnsetCommand = &cobra.Command{
+	Use:   "unset KEY...",
+	Short: "Unset environment variables",
+	Long: `Remove environment variables of the container running the project and
+roll out the change.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return changeEnv("unset", nil, args)
+	},
+}
+
+// This function is only executed once after the package is imported.
+func init() {
+	EnvCommand.PersistentFlags().StringVarP(&envService, "service", "s", "", "service whose container is used, required with multiple services")
+	EnvCommand.PersistentFlags().StringVarP(&envContainer, "container", "c", "", "container whose variables are used, defaults to the first configured container")
+	for _, cmd := range []*cobra.Command{EnvSetCommand, EnvUnsetCommand} {
+		cmd.Flags().BoolVarP(&confirmedControl, "yes", "y", false, "don't ask for confirmation on protected clusters")
+		cmd.Flags().BoolVarP(&asyncControl, "async", "a", false, "don't wait for rollout to complete")
+	}
+	EnvCommand.AddCommand(EnvListCommand, EnvSetCommand, EnvUnsetCommand)
+}
+
+// Set and unset environment variables of the deployed container and wait for the rollout.
+func changeEnv(command string, set map[string]string, unset []string) error {
+	cfg, svc, cls, w, container, err := envTarget(command)
+	if err != nil {
+		return err
+	}
+	names := append(sortedKeys(set), unset...)
+	cont, err := confirmProtected(cfg, fmt.Sprintf("%v %v of %v '%v'", command, strings.Join(names, ", "), w.Kind, w.Name))
+	if err != nil {
+		ui.FailMessage("Command canceled by user. No changes made.")
+		return err
+	}
+	if !cont {
+		ui.Message("No changes made.")
+		return nil
+	}
+	spin := ui.ShowSpinner(3, "Updating environment variables...")
+	err = web.SetContainerEnv(w, container, set, unset, cls)
+	if err != nil {
+		ui.SpinnerFail(3, "There was a problem updating environment variables.", spin)
+		ui.FailMessage(envFailMessage(command, err))
+		return err
+	}
+	if !asyncControl {
+		err = waitForRollout([]web.Workload{w}, cls)
+		if err != nil {
+			ui.SpinnerFail(3, "There was a problem updating environment variables.", spin)
+			ui.FailMessage(rolloutFailMessage(err))
+			return err
+		}
+	}
+	ui.SpinnerSuccess(3, fmt.Sprintf("Successfully updated environment variables of %v '%v'.", w.Kind, w.Name), spin)
+	for _, k := range sortedKeys(set) {
+		if _, ok := svc.Env[k]; ok {
+			ui.WarnMessage(fmt.Sprintf("%v is also defined in the env section of kubecli.yaml, the value set on the container takes precedence.", k))
+		}
+	}
+	return nil
+}
+
+// Read configuration and find the main workload and container of the selected service.
+func envTarget(command string) (config.Data, config.ServiceData, web.ClusterInfo, web.Workload, string, error) {
+	var cfg config.Data
+	var svc config.ServiceData
+	var cls web.ClusterInfo
+	var w web.Workload
+	spin := ui.ShowSpinner(1, "Reading configuration...")
+	// Get project root directory
+	cwd, err := executable.GetCwd()
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli env %v' command.", command))
+		return cfg, svc, cls, w, "", err
+	}
+	// Get YAML config path in project root
+	cp, err := config.GetPath(cwd)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't find kubecli YAML file in the project root. Try running 'kube-cli init' to create one.")
+		return cfg, svc, cls, w, "", err
+	}
+	// Parse project YAML config
+	cfg, err = config.Read(cp)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
+		return cfg, svc, cls, w, "", err
+	}
+	var names []string
+	if len(envService) > 0 {
+		names = []string{envService}
+	}
+	services, err := selectServices(cfg, names)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
+		return cfg, svc, cls, w, "", err
+	}
+	if len(services) > 1 {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Multiple services are defined in kubecli.yaml, rerun 'kube-cli env %v --service <service>' with the service to use.", command))
+		return cfg, svc, cls, w, "", errors.New("missing service name")
+	}
+	svc = services[0]
+	ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
+	spin = ui.ShowSpinner(2, "Connecting to the cluster...")
+	// Retrieve GKE cluster info
+	cls, err = web.GetGKECluster(cfg.Gke.Project, cfg.Gke.Zone, cfg.Gke.Cluster)
+	if err != nil {
+		ui.SpinnerFail(2, "There was a problem connecting to the cluster.", spin)
+		ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli env %v'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.", command))
+		return cfg, svc, cls, w, "", err
+	}
+	workloads, err := serviceWorkloads(cwd, cfg, svc, cls)
+	if err != nil {
+		ui.SpinnerFail(2, "There was a problem connecting to the cluster.", spin)
+		ui.FailMessage(workloadsFailMessage(svc, err))
+		return cfg, svc, cls, w, "", err
+	}
+	if len(workloads) == 0 {
+		ui.SpinnerFail(2, "There was a problem connecting to the cluster.", spin)
+		ui.FailMessage(fmt.Sprintf("Service '%v' doesn't define any workloads.", svc.Name))
+		return cfg, svc, cls, w, "", errors.New("no workloads")
+	}
+	w = workloads[0]
+	container := envContainer
+	if len(container) == 0 && len(w.Containers) > 0 {
+		container = w.Containers[0]
+	}
+	ui.SpinnerSuccess(2, "Successfully connected to the cluster.", spin)
+	return cfg, svc, cls, w, container, nil
+}
+
+// Describe why environment variables couldn't be changed and how to fix it.
+func envFailMessage(command string, err error) string {
+	switch e := err.(type) {
+	case *web.NotFoundError:
+		return fmt.Sprintf("Couldn't find %v '%v' in '%v' namespace. Run 'kube-cli deploy' to create it.", e.Kind, e.Name, e.Namespace)
+	case *web.ContainerNotFoundError:
+		return fmt.Sprintf("Couldn't find container '%v' in %v '%v'. Rerun the command with one of its containers.", e.Container, e.Kind, e.Workload)
+	case *web.PausedError:
+		return pausedFailMessage(e)
+	case *web.UnsupportedError:
+		return fmt.Sprintf("%v '%v' can't be changed without running it again. Change the env section of kubecli.yaml and run 'kube-cli deploy' instead.", e.Kind, e.Name)
+	}
+	return fmt.Sprintf("Please, retry 'kube-cli env %v'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.", command)
+}
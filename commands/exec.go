@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/executable"
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// How often the local terminal size is checked while a command runs.
+const terminalResize = 250 * time.Millisecond
+
+var execContainer string
+
+// ExecCommand runs a command in a pod of the workload running the project.
+var ExecCommand = &cobra.Command{
+	Use:   "exec [service] [-- command...]",
+	Short: "Run a command in a pod",
+	Long: `Run a command in a ready pod of the workload running the project, an
+interactive shell by default. When kubecli.yaml defines multiple services, the
+service must be given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		command := []string{"/bin/sh"}
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			if len(args) > dash {
+				command = args[dash:]
+			}
+			args = args[:dash]
+		}
+		if len(args) > 1 {
+			ui.FailMessage("Only one service can be given, put the command after '--' like 'kube-cli exec api -- ls -la'.")
+			return errors.New("too many arguments")
+		}
+		cls, w, pod, err := readyServicePod("exec", args)
+		if err != nil {
+			return err
+		}
+		container := execContainer
+		if len(container) == 0 && len(w.Containers) > 0 {
+			container = w.Containers[0]
+		}
+		streams := web.ExecStreams{
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		}
+		// Attach a TTY when used from a terminal, so interactive shells work
+		fd := int(os.Stdin.Fd())
+		if terminal.IsTerminal(fd) {
+			state, err := terminal.MakeRaw(fd)
+			if err != nil {
+				ui.FailMessage("Couldn't set up the terminal. Please, retry 'kube-cli exec'.")
+				return err
+			}
+			defer terminal.Restore(fd, state)
+			done := make(chan struct{})
+			defer close(done)
+			streams.TTY = true
+			streams.Sizes = terminalSizes(fd, done)
+		}
+		err = web.ExecPod(w.Namespace, pod, container, command, streams, cls)
+		if err != nil && streams.TTY {
+			// The terminal is still raw, print the error from the start of a line
+			fmt.Print("\r\n")
+		}
+		// Exit with the code of the command, like kubectl exec does
+		if e, ok := err.(*web.CommandExitError); ok {
+			return &ExitError{Code: e.Code, Err: err}
+		}
+		return err
+	},
+}
+
+// This function is only executed once after the package is imported.
+func init() {
+	ExecCommand.Flags().StringVarP(&execContainer, "container", "c", "", "container to run the command in, defaults to the first configured container")
+}
+
+// Read configuration and find a ready pod of the workload running a service.
+// Multiple workloads of a service are configured with the main one first.
+func readyServicePod(command string, args []string) (web.ClusterInfo, web.Workload, string, error) {
+	var cls web.ClusterInfo
+	var w web.Workload
+	spin := ui.ShowSpinner(1, "Reading configuration...")
+	// Get project root directory
+	cwd, err := executable.GetCwd()
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli %v' command.", command))
+		return cls, w, "", err
+	}
+	// Get YAML config path in project root
+	cp, err := config.GetPath(cwd)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't find kubecli YAML file in the project root. Try running 'kube-cli init' to create one.")
+		return cls, w, "", err
+	}
+	// Parse project YAML config
+	cfg, err := config.Read(cp)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
+		return cls, w, "", err
+	}
+	services, err := selectServices(cfg, args)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
+		return cls, w, "", err
+	}
+	if len(services) > 1 {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Multiple services are defined in kubecli.yaml, rerun 'kube-cli %v <service>' with the service to connect to.", command))
+		return cls, w, "", errors.New("missing service name")
+	}
+	svc := services[0]
+	ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
+	spin = ui.ShowSpinner(2, "Finding a ready pod...")
+	// Retrieve GKE cluster info
+	cls, err = web.GetGKECluster(cfg.Gke.Project, cfg.Gke.Zone, cfg.Gke.Cluster)
+	if err != nil {
+		ui.SpinnerFail(2, "There was a problem finding a ready pod.", spin)
+		ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli %v'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.", command))
+		return cls, w, "", err
+	}
+	workloads, err := serviceWorkloads(cwd, cfg, svc, cls)
+	if err != nil {
+		ui.SpinnerFail(2, "There was a problem finding a ready pod.", spin)
+		ui.FailMessage(workloadsFailMessage(svc, err))
+		return cls, w, "", err
+	}
+	if len(workloads) == 0 {
+		ui.SpinnerFail(2, "There was a problem finding a ready pod.", spin)
+		ui.FailMessage(fmt.Sprintf("Service '%v' doesn't define any workloads to connect to.", svc.Name))
+		return cls, w, "", errors.New("no workloads")
+	}
+	w = workloads[0]
+	pod, err := web.ReadyPod(w, cls)
+	if err != nil {
+		ui.SpinnerFail(2, "There was a problem finding a ready pod.", spin)
+		switch e := err.(type) {
+		case *web.NotFoundError:
+			ui.FailMessage(fmt.Sprintf("Couldn't find %v '%v' in '%v' namespace in cluster '%v'. Run 'kube-cli deploy' to create it.", e.Kind, e.Name, e.Namespace, cfg.Gke.Cluster))
+		case *web.NoReadyPodError:
+			ui.FailMessage(fmt.Sprintf("%v '%v' doesn't have a ready pod. Run 'kube-cli status' to see what's wrong.", e.Kind, e.Name))
+		default:
+			ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli %v'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.", command))
+		}
+		return cls, w, "", err
+	}
+	ui.SpinnerSuccess(2, fmt.Sprintf("Found ready pod '%v'.", pod), spin)
+	return cls, w, pod, nil
+}
+
+// Send the size of a terminal when it starts and whenever it changes, until done is closed.
+func terminalSizes(fd int, done <-chan struct{}) <-chan web.TerminalSize {
+	sizes := make(chan web.TerminalSize, 1)
+	go func() {
+		defer close(sizes)
+		var last web.TerminalSize
+		for {
+			if w, h, err := terminal.GetSize(fd); err == nil {
+				size := web.TerminalSize{Width: uint16(w), Height: uint16(h)}
+				if size != last {
+					last = size
+					select {
+					case sizes <- size:
+					case <-done:
+						return
+					}
+				}
+			}
+			select {
+			case <-time.After(terminalResize):
+			case <-done:
+				return
+			}
+		}
+	}()
+	return sizes
+}
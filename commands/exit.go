@@ -0,0 +1,11 @@
+package commands
+
+// ExitError is returned by commands which exit with a specific code instead of 1.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
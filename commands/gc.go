@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/executable"
+	"github.com/ajdnik/kube-cli/hash"
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var gcOlderThan int
+var gcKeep int
+var gcDryRun bool
+var gcYes bool
+
+// GCCommand deletes old source archives uploaded to GCP Storage by deploy.
+var GCCommand = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete old source archives",
+	Long: `Delete source archives uploaded by deploy which are older than
+the given number of days or beyond the given number of most recent archives
+per Docker image.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if gcOlderThan <= 0 && gcKeep <= 0 {
+			ui.FailMessage("Provide --older-than or --keep to choose which archives to delete.")
+			return errors.New("missing retention flags")
+		}
+		spin := ui.ShowSpinner(1, "Reading configuration...")
+		// Get project root directory
+		cwd, err := executable.GetCwd()
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Please, retry 'kube-cli gc' command.")
+			return err
+		}
+		// Get YAML config path in project root
+		cp, err := config.GetPath(cwd)
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Couldn't find kubecli YAML file in the project root. Try running 'kube-cli init' to create one.")
+			return err
+		}
+		// Parse project YAML config
+		cfg, err := config.Read(cp)
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
+			return err
+		}
+		ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
+		spin = ui.ShowSpinner(2, "Listing source archives...")
+		bName := sourceBucket(cfg)
+		objs, err := web.ListObjects(bName)
+		if err != nil {
+			ui.SpinnerFail(2, "There was a problem listing source archives.", spin)
+			ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli gc'. Make sure you have an active internet connection and 'Storage Admin' permissions on bucket '%v'.", bName))
+			return err
+		}
+		expired := selectExpiredArchives(objs, gcOlderThan, gcKeep, time.Now())
+		if len(expired) == 0 {
+			ui.SpinnerSuccess(2, "There are no source archives to delete.", spin)
+			return nil
+		}
+		var total int64
+		for _, o := range expired {
+			total += o.Size
+		}
+		ui.SpinnerSuccess(2, fmt.Sprintf("Found %v source archives to delete, %v in total.", len(expired), humanize.Bytes(uint64(total))), spin)
+		for _, o := range expired {
+			ui.Message(fmt.Sprintf("  %v (%v, %v)", o.Name, humanize.Bytes(uint64(o.Size)), humanize.Time(o.Created)))
+		}
+		if gcDryRun {
+			return nil
+		}
+		if !gcYes {
+			cont, err := ui.Confirm("Are you sure you want to delete these source archives?")
+			if err != nil {
+				ui.FailMessage("Command canceled by user. No archives deleted.")
+				return err
+			}
+			if !cont {
+				ui.Message("No archives were deleted.")
+				return nil
+			}
+		}
+		spin = ui.ShowSpinner(3, "Deleting source archives...")
+		for i, o := range expired {
+			err = web.DeleteObject(bName, o.Name)
+			if err != nil {
+				ui.SpinnerFail(3, fmt.Sprintf("There was a problem deleting source archive %v, deleted %v of %v archives.", o.Name, i, len(expired)), spin)
+				ui.FailMessage("Please, retry 'kube-cli gc'. Make sure you have an active internet connection and 'Storage Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+				return err
+			}
+		}
+		ui.SpinnerSuccess(3, fmt.Sprintf("Deleted %v source archives.", len(expired)), spin)
+		return nil
+	},
+}
+
+// This function is only executed once after the package is imported.
+func init() {
+	GCCommand.Flags().IntVar(&gcOlderThan, "older-than", 0, "delete archives older than the given number of days")
+	GCCommand.Flags().IntVar(&gcKeep, "keep", 0, "keep only the given number of most recent archives per image")
+	GCCommand.Flags().BoolVar(&gcDryRun, "dry-run", false, "only list archives that would be deleted")
+	GCCommand.Flags().BoolVarP(&gcYes, "yes", "y", false, "don't ask for confirmation before deleting")
+}
+
+// Select source archives older than the given number of days or beyond the
+// most recent archives to keep per image. Zero disables either rule. Archives
+// reused by a deploy are rewritten, so their age counts from the last deploy.
+func selectExpiredArchives(objs []web.StorageObject, olderThan, keep int, now time.Time) []web.StorageObject {
+	var expired []web.StorageObject
+	images := make(map[string][]web.StorageObject)
+	for _, o := range objs {
+		img, ok := archiveImage(o.Name)
+		if !ok {
+			continue
+		}
+		images[img] = append(images[img], o)
+	}
+	cutoff := now.AddDate(0, 0, -olderThan)
+	for _, archives := range images {
+		// Newest archives come first
+		sort.Slice(archives, func(i, j int) bool {
+			return archives[i].Created.After(archives[j].Created)
+		})
+		for i, o := range archives {
+			if (olderThan > 0 && o.Created.Before(cutoff)) || (keep > 0 && i >= keep) {
+				expired = append(expired, o)
+			}
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].Name < expired[j].Name
+	})
+	return expired
+}
+
+// Extract the Docker image name from a source archive named '<image>-<hash>.tar.gz',
+// where the hash is the sum of project files. Other objects in the bucket are ignored.
+func archiveImage(name string) (string, bool) {
+	if !strings.HasSuffix(name, ".tar.gz") {
+		return "", false
+	}
+	name = strings.TrimSuffix(name, ".tar.gz")
+	i := strings.LastIndex(name, "-")
+	if i <= 0 || !isHexSum(name[i+1:]) {
+		return "", false
+	}
+	return name[:i], true
+}
+
+// Check if a string is a hex encoded sum of project files.
+func isHexSum(s string) bool {
+	if len(s) != hash.Length {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/web"
+)
+
+// How long a hook Job can run when its timeout isn't set.
+const defaultHookTimeout = 10 * time.Minute
+
+// Run hook Jobs with the deployed image one after another and show their logs,
+// the first failing hook stops the rest. Jobs copy the pod spec of the main workload.
+func runHooks(svc config.ServiceData, hooks []config.HookData, image, tag string, main *web.Workload, cls web.ClusterInfo, rep serviceReporter) error {
+	for _, h := range hooks {
+		timeout, err := hookTimeout(h)
+		if err != nil {
+			return err
+		}
+		lines := make(chan web.LogLine)
+		done := make(chan struct{})
+		go func(name string) {
+			defer close(done)
+			for l := range lines {
+				if l.Err != nil {
+					rep.Warn(fmt.Sprintf("Couldn't stream logs of hook '%v': %v.", name, l.Err))
+					continue
+				}
+				rep.Log(name, l.Text)
+			}
+		}(h.Name)
+		err = web.RunHook(web.HookJob{
+			Name:         hookJobName(svc, h, tag),
+			Namespace:    hookNamespace(svc),
+			Image:        image,
+			Command:      h.Command,
+			EnvConfigMap: envConfigMap(svc),
+			EnvSecret:    envSecret(svc),
+			Timeout:      timeout,
+			Workload:     main,
+		}, cls, lines)
+		close(lines)
+		<-done
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run the post-deploy hooks of a service once its rollout completed and roll
+// back the deploy when one of them fails and hooks.rollback is set.
+func postDeploy(svc config.ServiceData, image, tag string, main *web.Workload, workloads []web.Workload, cls web.ClusterInfo, rep serviceReporter) error {
+	err := runHooks(svc, svc.Hooks.PostDeploy, image, tag, main, cls, rep)
+	if err == nil {
+		return nil
+	}
+	if !svc.Hooks.Rollback {
+		rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("%v The new version keeps running, run 'kube-cli rollback' to revert it.", hookFailMessage(err)))
+		return err
+	}
+	rerr := rollbackDeploy(svc, workloads, cls)
+	if rerr != nil {
+		rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("%v Rolling back the deploy failed too: %v. Run 'kube-cli rollback' to revert it.", hookFailMessage(err), rerr))
+		return err
+	}
+	rep.Fail(5, "There was a problem deploying the project.", fmt.Sprintf("%v The deploy was rolled back.", hookFailMessage(err)))
+	return err
+}
+
+// Roll back a deploy to the previous revision and wait for the rollback,
+// workloads which keep no history are left as they are.
+func rollbackDeploy(svc config.ServiceData, workloads []web.Workload, cls web.ClusterInfo) error {
+	if hasHelmRelease(svc) {
+		wait, err := helmTimeout(svc)
+		if err != nil {
+			return err
+		}
+		return web.RollbackRelease(helmReleaseName(svc), helmNamespace(svc), wait, cls)
+	}
+	var rolledBack []web.Workload
+	for _, w := range workloads {
+		err := web.RollbackWorkload(w, cls)
+		if _, ok := err.(*web.RollbackUnsupportedError); ok {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rolledBack = append(rolledBack, w)
+	}
+	return waitForRollout(rolledBack, cls)
+}
+
+// Warn that post-deploy hooks don't run when deploy doesn't wait for the rollout.
+func warnAsyncHooks(svc config.ServiceData, rep serviceReporter) {
+	if asyncDeploy && len(svc.Hooks.PostDeploy) > 0 {
+		rep.Warn("Post-deploy hooks weren't run, they run once the rollout completes and --async doesn't wait for it.")
+	}
+}
+
+// How long a hook Job can run, defaults to 10 minutes.
+func hookTimeout(h config.HookData) (time.Duration, error) {
+	if len(h.Timeout) == 0 {
+		return defaultHookTimeout, nil
+	}
+	return time.ParseDuration(h.Timeout)
+}
+
+// Name of the Job running a hook, unique for each deploy.
+func hookJobName(svc config.ServiceData, h config.HookData, tag string) string {
+	return fmt.Sprintf("%v-%v-%v", svc.Name, h.Name, tag)
+}
+
+// Namespace of hook Jobs, the same as the service's main workload so they can
+// load its env ConfigMap and Secret. When targets span several namespaces the
+// namespace of the first target is used.
+func hookNamespace(svc config.ServiceData) string {
+	return envNamespaces(svc)[0]
+}
+
+// The main workload of a service whose pod spec hook Jobs copy, which is the
+// first workload in the hook namespace. It's nil when the service has no hooks.
+func hookWorkload(cwd string, cfg config.Data, svc config.ServiceData, cls web.ClusterInfo) (*web.Workload, error) {
+	if len(svc.Hooks.PreDeploy) == 0 && len(svc.Hooks.PostDeploy) == 0 {
+		return nil, nil
+	}
+	workloads, err := serviceWorkloads(cwd, cfg, svc, cls)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range workloads {
+		if w.Namespace == hookNamespace(svc) {
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+// Describe why a hook failed and how to fix it.
+func hookFailMessage(err error) string {
+	if e, ok := err.(*web.HookFailedError); ok {
+		return fmt.Sprintf("Hook Job '%v' in '%v' namespace failed: %v. Check its logs with 'kubectl logs job/%v -n %v', fix the issue and rerun the command.", e.Name, e.Namespace, e.Reason, e.Name, e.Namespace)
+	}
+	return fmt.Sprintf("Couldn't run a hook Job: %v. Please, retry 'kube-cli deploy'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.", err)
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ajdnik/kube-cli/filesystem"
+	gitignore "github.com/denormal/go-gitignore"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// ignoreMatcher decides which build context files are left out of the archive,
+// combining .kubecliignore rules with Docker's .dockerignore rules.
+type ignoreMatcher struct {
+	dir        string
+	kubecli    gitignore.GitIgnore
+	docker     *patternmatcher.PatternMatcher
+	dockerfile string
+	mu         sync.Mutex
+}
+
+// Load ignore rules from .kubecliignore and .dockerignore files in the build
+// context directory. The Dockerfile path is relative to the build context.
+func newIgnoreMatcher(dir, dockerfile string) (*ignoreMatcher, error) {
+	m := &ignoreMatcher{
+		dir:        dir,
+		kubecli:    gitignore.New(strings.NewReader(".git\n.kubecliignore"), dir, nil),
+		dockerfile: filepath.FromSlash(dockerfile),
+	}
+	var err error
+	// Load .kubecliignore if it exists
+	ip := filepath.Join(dir, ".kubecliignore")
+	if filesystem.FileExists(ip) {
+		m.kubecli, err = gitignore.NewFromFile(ip)
+		if err != nil {
+			return m, err
+		}
+	}
+	// Load .dockerignore if it exists
+	dp := filepath.Join(dir, ".dockerignore")
+	if filesystem.FileExists(dp) {
+		f, err := os.Open(dp)
+		if err != nil {
+			return m, err
+		}
+		defer f.Close()
+		patterns, err := ignorefile.ReadAll(f)
+		if err != nil {
+			return m, err
+		}
+		m.docker, err = patternmatcher.New(patterns)
+		if err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// Ignore reports whether a project file or directory should be left out of the archive.
+func (m *ignoreMatcher) Ignore(path string, dir bool) (bool, error) {
+	// Patterns are compiled lazily, so matching isn't safe for concurrent use
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if match := m.kubecli.Absolute(path, dir); match != nil && match.Ignore() {
+		return true, nil
+	}
+	if m.docker == nil {
+		return false, nil
+	}
+	// Exceptions can include files inside of excluded directories,
+	// so those directories have to be walked
+	if dir && m.docker.Exclusions() {
+		return false, nil
+	}
+	// Docker matches patterns against paths relative to the build context
+	rel, err := filepath.Rel(m.dir, path)
+	if err != nil {
+		return false, err
+	}
+	// Like docker build, always send the Dockerfile and .dockerignore
+	if rel == m.dockerfile || rel == ".dockerignore" {
+		return false, nil
+	}
+	return m.docker.MatchesOrParentMatches(rel)
+}
+
+// Prune drops directories excluded by .dockerignore which were only walked to
+// look for exceptions, unless an exception kept something inside of them.
+func (m *ignoreMatcher) Prune(files []string) ([]string, error) {
+	if m.docker == nil || !m.docker.Exclusions() {
+		return files, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	excluded := make(map[string]bool)
+	kept := make(map[string]bool)
+	for _, f := range files {
+		rel, err := filepath.Rel(m.dir, f)
+		if err != nil {
+			return nil, err
+		}
+		match, err := m.docker.MatchesOrParentMatches(rel)
+		if err != nil {
+			return nil, err
+		}
+		if match && rel != m.dockerfile && rel != ".dockerignore" {
+			excluded[f] = true
+			continue
+		}
+		// Parents of included files have to stay in the archive
+		for d := filepath.Dir(f); d != m.dir && !kept[d]; d = filepath.Dir(d) {
+			kept[d] = true
+		}
+	}
+	var pruned []string
+	for _, f := range files {
+		if !excluded[f] || kept[f] {
+			pruned = append(pruned, f)
+		}
+	}
+	return pruned, nil
+}
@@ -28,28 +28,6 @@ some questions.`,
 			ui.FailMessage("Please, retry 'kube-cli init' command.")
 			return err
 		}
-		// Verify Dockerfile exists in project root
-		df := filepath.Join(cwd, "Dockerfile")
-		if !filesystem.FileExists(df) {
-			ui.WarnMessage("Couldn't find Dockerfile in the project root. See https://docs.docker.com/engine/reference/builder/ for further info.")
-		}
-		// Create new ignore file if user requests
-		ip := filepath.Join(cwd, ".kubecliignore")
-		if !filesystem.FileExists(ip) {
-			create, err := ui.Confirm(".kubecliignore was not found in the project root. Would you like to create a generic one?")
-			if err != nil {
-				ui.FailMessage("Command canceled by user. No changes made.")
-				return err
-			}
-			if create {
-				err = ioutil.WriteFile(ip, []byte(".git/**/*\n.kubecliignore\nkubecli.yaml\nkubecli.yml"), 0644)
-				if err != nil {
-					ui.FailMessage("Please, retry 'kube-cli init' command. Try running it as an administrator.")
-					return err
-				}
-				ui.SuccessMessage("Created a generic .kubecliignore file.")
-			}
-		}
 		// Load existing YAML config, if it exists
 		var cfg config.Data
 		cp, err := config.GetPath(cwd)
@@ -97,6 +75,24 @@ some questions.`,
 			ui.FailMessage("Command canceled by user. No changes made.")
 			return err
 		}
+		ctx := cfg.Docker.Context
+		if len(ctx) == 0 {
+			ctx = "."
+		}
+		cfg.Docker.Context, err = ui.Ask("Docker Context", "Directory used as the Docker build context, relative to the project root.", ctx, validRelativePath)
+		if err != nil {
+			ui.FailMessage("Command canceled by user. No changes made.")
+			return err
+		}
+		df := cfg.Docker.Dockerfile
+		if len(df) == 0 {
+			df = filepath.ToSlash(filepath.Join(cfg.Docker.Context, "Dockerfile"))
+		}
+		cfg.Docker.Dockerfile, err = ui.Ask("Dockerfile", "Path of the Dockerfile inside of the build context, relative to the project root.", df, validRelativePath)
+		if err != nil {
+			ui.FailMessage("Command canceled by user. No changes made.")
+			return err
+		}
 		cfg.Deployment.Name, err = ui.Ask("Deployment Name", "Name of the Kubernetes deployment where the project is deployed.", cfg.Deployment.Name, validDashName)
 		if err != nil {
 			ui.FailMessage("Command canceled by user. No changes made.")
@@ -112,6 +108,29 @@ some questions.`,
 			ui.FailMessage("Command canceled by user. No changes made.")
 			return err
 		}
+		// Verify Dockerfile exists inside of the build context
+		if _, err := contextDockerfile(cwd, cfg.Docker); err != nil {
+			ui.WarnMessage(fmt.Sprintf("Dockerfile %v is outside of the build context %v, 'kube-cli deploy' won't be able to build the project.", dockerfilePath(cwd, cfg.Docker), contextDir(cwd, cfg.Docker)))
+		} else if !filesystem.FileExists(dockerfilePath(cwd, cfg.Docker)) {
+			ui.WarnMessage(fmt.Sprintf("Couldn't find Dockerfile at %v. See https://docs.docker.com/engine/reference/builder/ for further info.", dockerfilePath(cwd, cfg.Docker)))
+		}
+		// Create new ignore file in the build context if user requests
+		ip := filepath.Join(contextDir(cwd, cfg.Docker), ".kubecliignore")
+		if !filesystem.FileExists(ip) {
+			create, err := ui.Confirm(".kubecliignore was not found in the build context. Would you like to create a generic one?")
+			if err != nil {
+				ui.FailMessage("Command canceled by user. No changes made.")
+				return err
+			}
+			if create {
+				err = ioutil.WriteFile(ip, []byte(".git\n.kubecliignore\nkubecli.yaml\nkubecli.yml"), 0644)
+				if err != nil {
+					ui.FailMessage("Please, retry 'kube-cli init' command. Try running it as an administrator.")
+					return err
+				}
+				ui.SuccessMessage("Created a generic .kubecliignore file.")
+			}
+		}
 		// Save config to YAML file
 		err = config.Write(cp, cfg)
 		if err != nil {
@@ -133,6 +152,14 @@ func validDashName(input interface{}) error {
 	return nil
 }
 
+// Validate user input is a relative path.
+func validRelativePath(input interface{}) error {
+	if str, ok := input.(string); !ok || len(str) == 0 || filepath.IsAbs(str) {
+		return errors.New("must be a path relative to the project root, for example services/api")
+	}
+	return nil
+}
+
 // Generate GCP zone names from regions and supported zones.
 func genZones() []string {
 	regions := make(map[string][]string)
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/executable"
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
+	"github.com/spf13/cobra"
+)
+
+var logsContainer string
+var logsSince time.Duration
+var logsTail int64
+var followLogs bool
+var previousLogs bool
+
+// LogsCommand streams logs of all pods running the project.
+var LogsCommand = &cobra.Command{
+	Use:   "logs [service...]",
+	Short: "Show deployment logs",
+	Long: `Stream logs of all pods of the workloads running the project. Each line
+is prefixed with the pod and container it comes from. When following, logs of
+new pods are streamed as they appear during a rollout.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spin := ui.ShowSpinner(1, "Reading configuration...")
+		// Get project root directory
+		cwd, err := executable.GetCwd()
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Please, retry 'kube-cli logs' command.")
+			return err
+		}
+		// Get YAML config path in project root
+		cp, err := config.GetPath(cwd)
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Couldn't find kubecli YAML file in the project root. Try running 'kube-cli init' to create one.")
+			return err
+		}
+		// Parse project YAML config
+		cfg, err := config.Read(cp)
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
+			return err
+		}
+		services, err := selectServices(cfg, args)
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
+			return err
+		}
+		ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
+		spin = ui.ShowSpinner(2, "Connecting to the cluster...")
+		// Retrieve GKE cluster info
+		cls, err := web.GetGKECluster(cfg.Gke.Project, cfg.Gke.Zone, cfg.Gke.Cluster)
+		if err != nil {
+			ui.SpinnerFail(2, "There was a problem connecting to the cluster.", spin)
+			ui.FailMessage("Please, retry 'kube-cli logs'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+			return err
+		}
+		var workloads []web.Workload
+		for _, svc := range services {
+			w, err := serviceWorkloads(cwd, cfg, svc, cls)
+			if err != nil {
+				ui.SpinnerFail(2, "There was a problem connecting to the cluster.", spin)
+				ui.FailMessage(workloadsFailMessage(svc, err))
+				return err
+			}
+			workloads = append(workloads, w...)
+		}
+		ui.SpinnerSuccess(2, "Successfully connected to the cluster.", spin)
+		opts := web.LogOptions{
+			Container: logsContainer,
+			Since:     logsSince,
+			Tail:      logsTail,
+			Follow:    followLogs,
+			Previous:  previousLogs,
+		}
+		// Stream logs of all workloads concurrently, lines are printed as they arrive
+		lines := make(chan web.LogLine)
+		errs := make([]error, len(workloads))
+		var wg sync.WaitGroup
+		for i, w := range workloads {
+			wg.Add(1)
+			go func(i int, w web.Workload) {
+				defer wg.Done()
+				errs[i] = web.StreamLogs(w, opts, cls, lines)
+			}(i, w)
+		}
+		go func() {
+			wg.Wait()
+			close(lines)
+		}()
+		for l := range lines {
+			source := fmt.Sprintf("%v/%v", l.Pod, l.Container)
+			if l.Err != nil {
+				ui.WarnMessage(fmt.Sprintf("Couldn't stream logs of %v: %v.", source, l.Err))
+				continue
+			}
+			ui.LogLine(source, l.Text)
+		}
+		for _, err := range errs {
+			if err == nil {
+				continue
+			}
+			switch e := err.(type) {
+			case *web.NotFoundError:
+				ui.FailMessage(fmt.Sprintf("Couldn't find %v '%v' in '%v' namespace in cluster '%v'. Run 'kube-cli deploy' to create it.", e.Kind, e.Name, e.Namespace, cfg.Gke.Cluster))
+			case *web.ContainerNotFoundError:
+				ui.FailMessage(fmt.Sprintf("Couldn't find container '%v' in %v '%v'. Rerun the command with one of its containers.", e.Container, e.Kind, e.Workload))
+			default:
+				ui.FailMessage("Please, retry 'kube-cli logs'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+			}
+			return err
+		}
+		return nil
+	},
+}
+
+// This function is only executed once after the package is imported.
+func init() {
+	LogsCommand.Flags().StringVarP(&logsContainer, "container", "c", "", "only show logs of this container")
+	LogsCommand.Flags().DurationVar(&logsSince, "since", 0, "only show logs newer than a relative duration like 5m or 1h")
+	LogsCommand.Flags().Int64Var(&logsTail, "tail", -1, "number of most recent lines to show from each container, all lines by default")
+	LogsCommand.Flags().BoolVarP(&followLogs, "follow", "f", false, "keep streaming logs, including logs of new pods")
+	LogsCommand.Flags().BoolVarP(&previousLogs, "previous", "p", false, "show logs of the previous instance of restarted containers")
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
+	"github.com/spf13/cobra"
+)
+
+// Ports given like PORT, LOCAL:REMOTE or :REMOTE for a random local port.
+var portPattern = regexp.MustCompile(`^(\d+)?(:\d+)?$`)
+
+// PortForwardCommand forwards local ports to a pod of the workload running the project.
+var PortForwardCommand = &cobra.Command{
+	Use:   "port-forward [service] port...",
+	Short: "Forward local ports to a pod",
+	Long: `Forward local ports to a ready pod of the workload running the project.
+Ports are given as PORT or LOCAL:REMOTE. When kubecli.yaml defines multiple
+services, the service must be given before the ports.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var services []string
+		if !validPort(args[0]) {
+			services, args = args[:1], args[1:]
+		}
+		if len(args) == 0 {
+			ui.FailMessage("Give the ports to forward, for example 'kube-cli port-forward 8080:80'.")
+			return errors.New("missing ports")
+		}
+		for _, p := range args {
+			if !validPort(p) {
+				ui.FailMessage(fmt.Sprintf("Port '%v' isn't valid, give ports as PORT or LOCAL:REMOTE, for example 8080:80.", p))
+				return errors.New("invalid port")
+			}
+		}
+		cls, w, pod, err := readyServicePod("port-forward", services)
+		if err != nil {
+			return err
+		}
+		// Forward until the command is interrupted
+		stop := make(chan struct{})
+		ready := make(chan struct{})
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		go func() {
+			<-interrupt
+			close(stop)
+		}()
+		go func() {
+			<-ready
+			ui.Message("Press Ctrl+C to stop forwarding.")
+		}()
+		err = web.ForwardPorts(w.Namespace, pod, args, stop, ready, os.Stdout, cls)
+		if err != nil {
+			ui.FailMessage(fmt.Sprintf("Couldn't forward ports to pod '%v': %v. Make sure the local ports are free and rerun the command.", pod, err))
+			return err
+		}
+		return nil
+	},
+}
+
+// Check if an argument is a port to forward.
+func validPort(arg string) bool {
+	return len(arg) > 0 && arg != ":" && portPattern.MatchString(arg)
+}
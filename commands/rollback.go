@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ajdnik/kube-cli/config"
@@ -14,9 +16,11 @@ var asyncRollback bool
 
 // RollbackCommand rolls back a Kubernetes deployment to a previous state.
 var RollbackCommand = &cobra.Command{
-	Use:   "rollback",
+	Use:   "rollback [service]",
 	Short: "Rollback deployment",
-	Long:  `Rollback deployment to a previous state.`,
+	Long: `Rollback deployment to a previous state. When kubecli.yaml defines
+multiple services, the service to roll back must be given.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		spin := ui.ShowSpinner(1, "Reading configuration...")
 		// Get project root directory
@@ -40,6 +44,28 @@ var RollbackCommand = &cobra.Command{
 			ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
 			return err
 		}
+		services, err := selectServices(cfg, args)
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
+			return err
+		}
+		if len(services) > 1 {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Multiple services are defined in kubecli.yaml, rerun 'kube-cli rollback <service>' with the service to roll back.")
+			return errors.New("missing service name")
+		}
+		svc := services[0]
+		targets := targetWorkloads(svc.Deployment)
+		if hasManifests(svc) {
+			// Roll back the workloads defined by the manifests
+			targets, err = manifestWorkloads(cwd, cfg, svc)
+			if err != nil {
+				ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+				ui.FailMessage(manifestFailMessage(err))
+				return err
+			}
+		}
 		ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
 		spin = ui.ShowSpinner(2, "Rolling back deployment...")
 		// Retrieve GKE cluster info
@@ -49,29 +75,74 @@ var RollbackCommand = &cobra.Command{
 			ui.FailMessage("Please, retry 'kube-cli rollback'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
 			return err
 		}
-		// Rollback deployment
-		err = web.RollbackDeployment(cfg.Deployment.Namespace, cfg.Deployment.Name, cls)
-		if err != nil {
+		if hasHelmRelease(svc) {
+			// Roll back the Helm release to its previous revision
+			wait, err := helmTimeout(svc)
+			if err != nil || asyncRollback {
+				wait = 0
+			}
+			err = web.RollbackRelease(helmReleaseName(svc), helmNamespace(svc), wait, cls)
+			if err != nil {
+				ui.SpinnerFail(2, "There was a problem rolling back the deployment.", spin)
+				ui.FailMessage(fmt.Sprintf("Couldn't roll back Helm release '%v': %v.", helmReleaseName(svc), err))
+				return err
+			}
+			ui.SpinnerSuccess(2, fmt.Sprintf("Successfully rolled back Helm release '%v'.", helmReleaseName(svc)), spin)
+			return nil
+		}
+		// Rollback all workloads updated by deploy, jobs and cron jobs keep no history
+		var workloads []web.Workload
+		var skipped []string
+		for _, w := range targets {
+			err = web.RollbackWorkload(w, cls)
+			if _, ok := err.(*web.RollbackUnsupportedError); ok {
+				skipped = append(skipped, fmt.Sprintf("%v '%v' can't be rolled back, rerun 'kube-cli deploy' from the previous version of the project to revert it.", w.Kind, w.Name))
+				continue
+			}
+			if err != nil {
+				ui.SpinnerFail(2, "There was a problem rolling back the deployment.", spin)
+				if e, ok := err.(*web.NotFoundError); ok {
+					ui.FailMessage(fmt.Sprintf("Couldn't find %v '%v' in '%v' namespace in cluster '%v'.", e.Kind, e.Name, e.Namespace, cfg.Gke.Cluster))
+					return err
+				}
+				ui.FailMessage("Please, retry 'kube-cli rollback'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+				return err
+			}
+			workloads = append(workloads, w)
+		}
+		if len(workloads) == 0 {
 			ui.SpinnerFail(2, "There was a problem rolling back the deployment.", spin)
-			ui.FailMessage("Please, retry 'kube-cli rollback'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
-			return err
+			for _, msg := range skipped {
+				ui.FailMessage(msg)
+			}
+			return errors.New("no workloads to roll back")
 		}
 		if asyncRollback {
 			ui.SpinnerSuccess(2, "Successfully started the rollback of the deployment. You can keep track of the progress at https://console.cloud.google.com/kubernetes/workload.", spin)
+			warnSkipped(skipped)
 			return nil
 		}
-		// Periodically check deployment
+		// Periodically check workloads until all of them are rolled out
 		running := true
 		timeout := 1
 		maxTimeout := 60
 		for running {
-			cnt, err := web.UnavailableReplicas(cfg.Deployment.Namespace, cfg.Deployment.Name, cls)
-			if err != nil {
-				ui.SpinnerFail(2, "There was a problem rolling back the deployment.", spin)
-				ui.FailMessage("Something unexpected happened. Please check on the status of the rollback on the Google Cloud Console https://console.cloud.google.com/kubernetes/workload.")
-				return err
+			done := true
+			for _, w := range workloads {
+				complete, err := web.RolloutComplete(w, cls)
+				if e, ok := err.(*web.PausedError); ok {
+					ui.SpinnerFail(2, "There was a problem rolling back the deployment.", spin)
+					ui.FailMessage(pausedFailMessage(e))
+					return err
+				}
+				if err != nil {
+					ui.SpinnerFail(2, "There was a problem rolling back the deployment.", spin)
+					ui.FailMessage("Something unexpected happened. Please check on the status of the rollback on the Google Cloud Console https://console.cloud.google.com/kubernetes/workload.")
+					return err
+				}
+				done = done && complete
 			}
-			if cnt == 0 {
+			if done {
 				running = false
 				break
 			}
@@ -82,6 +153,7 @@ var RollbackCommand = &cobra.Command{
 			time.Sleep(time.Duration(timeout) * time.Second)
 		}
 		ui.SpinnerSuccess(2, "Successfully rolled back deployment.", spin)
+		warnSkipped(skipped)
 		return nil
 	},
 }
@@ -90,3 +162,10 @@ var RollbackCommand = &cobra.Command{
 func init() {
 	RollbackCommand.Flags().BoolVarP(&asyncRollback, "async", "a", false, "don't wait for rollback operation to complete")
 }
+
+// Print warnings about workloads which weren't rolled back.
+func warnSkipped(skipped []string) {
+	for _, msg := range skipped {
+		ui.WarnMessage(msg)
+	}
+}
@@ -0,0 +1,347 @@
+package commands
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/executable"
+	"github.com/ajdnik/kube-cli/hash"
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Secret version used when the secrets section doesn't pin one.
+const latestSecretVersion = "latest"
+
+// Size in bytes of values generated by 'kube-cli secrets rotate --generate'.
+const generatedSecretSize = 32
+
+var secretsService string
+var generateSecret bool
+var keepSecretVersions bool
+
+// SecretsCommand groups commands managing Secret Manager secrets of the project.
+var SecretsCommand = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage secrets",
+	Long: `List, set and rotate secrets stored in Secret Manager. Secrets defined in
+the secrets section of kubecli.yaml are loaded into a Secret on deploy, which the
+container reads as environment variables. Secret values are never printed.`,
+}
+
+// SecretsListCommand lists secrets of a service and their versions.
+var SecretsListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List secrets",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, svc, err := secretsTarget("list")
+		if err != nil {
+			return err
+		}
+		if !hasSecrets(svc) {
+			ui.Message(fmt.Sprintf("Service '%v' doesn't define any secrets, add them to the secrets section of kubecli.yaml.", svc.Name))
+			return nil
+		}
+		spin := ui.ShowSpinner(2, "Reading secret versions...")
+		rows := []string{"NAME\tSECRET\tVERSION\tLATEST\tCREATED"}
+		for _, s := range svc.Secrets {
+			latest, err := web.LatestSecretVersion(cfg.Gke.Project, secretID(s))
+			if _, ok := err.(*web.SecretNotFoundError); ok {
+				rows = append(rows, fmt.Sprintf("%v\t%v\t%v\t-\t-", s.Name, secretID(s), secretVersion(s)))
+				continue
+			}
+			if err != nil {
+				ui.SpinnerFail(2, "There was a problem reading secret versions.", spin)
+				ui.FailMessage(secretsFailMessage(err))
+				return err
+			}
+			rows = append(rows, fmt.Sprintf("%v\t%v\t%v\t%v\t%v", s.Name, secretID(s), secretVersion(s), latest.Version, humanize.Time(latest.Created)))
+		}
+		ui.SpinnerSuccess(2, "Successfully read secret versions.", spin)
+		printTable(rows)
+		return nil
+	},
+}
+
+// SecretsSetCommand adds a new version to a secret.
+var SecretsSetCommand = &cobra.Command{
+	Use:   "set NAME",
+	Short: "Set a secret",
+	Long: `Add a new version with a value to a secret, creating the secret when it
+doesn't exist. The value is read from a hidden prompt, or from standard input
+when it isn't a terminal. NAME is either a name from the secrets section of
+kubecli.yaml or a Secret Manager secret id.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, svc, err := secretsTarget("set")
+		if err != nil {
+			return err
+		}
+		s := configuredSecret(svc, args[0])
+		value, err := readSecretValue(secretID(s))
+		if err != nil {
+			ui.FailMessage("Couldn't read the secret value. No changes made.")
+			return err
+		}
+		spin := ui.ShowSpinner(2, "Adding secret version...")
+		v, err := web.AddSecretVersion(cfg.Gke.Project, secretID(s), value)
+		if err != nil {
+			ui.SpinnerFail(2, "There was a problem adding the secret version.", spin)
+			ui.FailMessage(secretsFailMessage(err))
+			return err
+		}
+		ui.SpinnerSuccess(2, fmt.Sprintf("Successfully added version %v of secret '%v'.", v.Version, v.Secret), spin)
+		warnSecretVersion(s, v.Version)
+		return nil
+	},
+}
+
+// SecretsRotateCommand replaces a secret value and disables its previous versions.
+var SecretsRotateCommand = &cobra.Command{
+	Use:   "rotate NAME",
+	Short: "Rotate a secret",
+	Long: `Add a new version to a secret and disable all of its previous versions.
+The value is read the same way as with 'kube-cli secrets set', or generated
+randomly with --generate.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, svc, err := secretsTarget("rotate")
+		if err != nil {
+			return err
+		}
+		s := configuredSecret(svc, args[0])
+		var value []byte
+		if generateSecret {
+			value, err = randomSecret()
+		} else {
+			value, err = readSecretValue(secretID(s))
+		}
+		if err != nil {
+			ui.FailMessage("Couldn't read the secret value. No changes made.")
+			return err
+		}
+		spin := ui.ShowSpinner(2, "Rotating secret...")
+		v, err := web.AddSecretVersion(cfg.Gke.Project, secretID(s), value)
+		if err != nil {
+			ui.SpinnerFail(2, "There was a problem rotating the secret.", spin)
+			ui.FailMessage(secretsFailMessage(err))
+			return err
+		}
+		disabled := 0
+		if !keepSecretVersions {
+			disabled, err = web.DisableSecretVersions(cfg.Gke.Project, secretID(s), v.Version)
+			if err != nil {
+				ui.SpinnerFail(2, "There was a problem rotating the secret.", spin)
+				ui.FailMessage(fmt.Sprintf("Added version %v of secret '%v', but couldn't disable previous versions. Please, retry 'kube-cli secrets rotate %v --keep' later or disable them in the Cloud Console.", v.Version, v.Secret, args[0]))
+				return err
+			}
+		}
+		ui.SpinnerSuccess(2, fmt.Sprintf("Successfully added version %v of secret '%v' and disabled %v previous versions.", v.Version, v.Secret, disabled), spin)
+		warnSecretVersion(s, v.Version)
+		return nil
+	},
+}
+
+// This function is only executed once after the package is imported.
+func init() {
+	SecretsCommand.PersistentFlags().StringVarP(&secretsService, "service", "s", "", "service whose secrets are used, required with multiple services")
+	SecretsRotateCommand.Flags().BoolVarP(&generateSecret, "generate", "g", false, "generate a random value instead of reading it")
+	SecretsRotateCommand.Flags().BoolVarP(&keepSecretVersions, "keep", "k", false, "don't disable previous versions")
+	SecretsCommand.AddCommand(SecretsListCommand, SecretsSetCommand, SecretsRotateCommand)
+}
+
+// Read configuration and select the service whose secrets are managed.
+func secretsTarget(command string) (config.Data, config.ServiceData, error) {
+	var cfg config.Data
+	var svc config.ServiceData
+	spin := ui.ShowSpinner(1, "Reading configuration...")
+	// Get project root directory
+	cwd, err := executable.GetCwd()
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli secrets %v' command.", command))
+		return cfg, svc, err
+	}
+	// Get YAML config path in project root
+	cp, err := config.GetPath(cwd)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't find kubecli YAML file in the project root. Try running 'kube-cli init' to create one.")
+		return cfg, svc, err
+	}
+	// Parse project YAML config
+	cfg, err = config.Read(cp)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
+		return cfg, svc, err
+	}
+	var names []string
+	if len(secretsService) > 0 {
+		names = []string{secretsService}
+	}
+	services, err := selectServices(cfg, names)
+	if err != nil {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
+		return cfg, svc, err
+	}
+	if len(services) > 1 {
+		ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+		ui.FailMessage(fmt.Sprintf("Multiple services are defined in kubecli.yaml, rerun 'kube-cli secrets %v --service <service>' with the service to use.", command))
+		return cfg, svc, errors.New("missing service name")
+	}
+	svc = services[0]
+	ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
+	return cfg, svc, nil
+}
+
+// Find a secret of a service by its name, names which aren't configured are
+// used as Secret Manager secret ids.
+func configuredSecret(svc config.ServiceData, name string) config.SecretData {
+	for _, s := range svc.Secrets {
+		if s.Name == name {
+			return s
+		}
+	}
+	return config.SecretData{Secret: name}
+}
+
+// Read a secret value from a hidden prompt or from standard input when it isn't a terminal.
+func readSecretValue(secret string) ([]byte, error) {
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		value, err := ui.AskSecret(fmt.Sprintf("Value of secret '%v':", secret), "The value is stored in Secret Manager and isn't shown.")
+		return []byte(value), err
+	}
+	value, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	value = []byte(strings.TrimRight(string(value), "\r\n"))
+	if len(value) == 0 {
+		return nil, errors.New("empty secret value")
+	}
+	return value, nil
+}
+
+// Generate a random URL safe secret value.
+func randomSecret() ([]byte, error) {
+	buf := make([]byte, generatedSecretSize)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.RawURLEncoding.EncodeToString(buf)), nil
+}
+
+// Tell the user how a new secret version reaches the deployment.
+func warnSecretVersion(s config.SecretData, version string) {
+	if len(s.Name) == 0 {
+		ui.WarnMessage(fmt.Sprintf("Secret '%v' isn't in the secrets section of kubecli.yaml, add it to load it into the deployment.", secretID(s)))
+		return
+	}
+	if secretVersion(s) != latestSecretVersion {
+		ui.WarnMessage(fmt.Sprintf("Secret '%v' is pinned to version %v in kubecli.yaml, change it to %v and run 'kube-cli deploy' to use the new value.", s.Name, s.Version, version))
+		return
+	}
+	ui.Message("Run 'kube-cli deploy' to load the new value into the deployment.")
+}
+
+// Describe why secrets couldn't be read or changed and how to fix it.
+func secretsFailMessage(err error) string {
+	if e, ok := err.(*web.SecretNotFoundError); ok {
+		return fmt.Sprintf("Couldn't find version %v of secret '%v' in Secret Manager. Add it with 'kube-cli secrets set' or fix the secrets section of kubecli.yaml.", e.Version, e.Secret)
+	}
+	return "Couldn't access Secret Manager. Make sure you have an active internet connection and 'Secret Manager Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS."
+}
+
+// Check if the service defines any secrets.
+func hasSecrets(svc config.ServiceData) bool {
+	return len(svc.Secrets) > 0
+}
+
+// Name of the Secret with the secrets section of a service.
+func envSecretName(svc config.ServiceData) string {
+	return fmt.Sprintf("%v-secrets", svc.Name)
+}
+
+// Name of the Secret of a service, empty when the service doesn't have one.
+func envSecret(svc config.ServiceData) string {
+	if !hasSecrets(svc) {
+		return ""
+	}
+	return envSecretName(svc)
+}
+
+// Secret Manager secret id of a secret, defaults to its name.
+func secretID(s config.SecretData) string {
+	if len(s.Secret) > 0 {
+		return s.Secret
+	}
+	return s.Name
+}
+
+// Configured version of a secret, defaults to the latest version.
+func secretVersion(s config.SecretData) string {
+	if len(s.Version) > 0 {
+		return s.Version
+	}
+	return latestSecretVersion
+}
+
+// Resolve the versions of the secrets of a service without accessing their
+// values, keyed by secret name.
+func secretVersions(cfg config.Data, svc config.ServiceData) (map[string]string, error) {
+	versions := make(map[string]string)
+	for _, s := range svc.Secrets {
+		version := secretVersion(s)
+		if version == latestSecretVersion {
+			latest, err := web.LatestSecretVersion(cfg.Gke.Project, secretID(s))
+			if err != nil {
+				return nil, err
+			}
+			version = latest.Version
+		}
+		versions[s.Name] = fmt.Sprintf("%v/%v", secretID(s), version)
+	}
+	return versions, nil
+}
+
+// Checksum of the resolved versions of the secrets of a service, empty when
+// the service doesn't have any.
+func secretVersionsChecksum(cfg config.Data, svc config.ServiceData) (string, error) {
+	if !hasSecrets(svc) {
+		return "", nil
+	}
+	versions, err := secretVersions(cfg, svc)
+	if err != nil {
+		return "", err
+	}
+	return hash.SumValues(versions), nil
+}
+
+// Access the values of the secrets of a service together with the versions
+// they resolve to, both keyed by secret name.
+func accessSecrets(cfg config.Data, svc config.ServiceData) (map[string][]byte, map[string]string, error) {
+	data := make(map[string][]byte)
+	versions := make(map[string]string)
+	for _, s := range svc.Secrets {
+		value, version, err := web.AccessSecret(cfg.Gke.Project, secretID(s), secretVersion(s))
+		if err != nil {
+			return nil, nil, err
+		}
+		data[s.Name] = value
+		versions[s.Name] = fmt.Sprintf("%v/%v", secretID(s), version)
+	}
+	return data, versions, nil
+}
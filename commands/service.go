@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/briandowns/spinner"
+	humanize "github.com/dustin/go-humanize"
+)
+
+// Select services by name, all services are selected when no names are given.
+func selectServices(cfg config.Data, names []string) ([]config.ServiceData, error) {
+	all := cfg.AllServices()
+	if len(names) == 0 {
+		return all, nil
+	}
+	var selected []config.ServiceData
+	for _, name := range names {
+		found := false
+		for _, svc := range all {
+			if svc.Name == name {
+				selected = append(selected, svc)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return selected, fmt.Errorf("service '%v' isn't defined in kubecli.yaml", name)
+		}
+	}
+	return selected, nil
+}
+
+// Maximum length of a status line showing a log line on the status board.
+const boardLogWidth = 100
+
+// serviceReporter shows the progress of a multi step workflow for a service.
+type serviceReporter interface {
+	// Start shows a new step in progress.
+	Start(step int8, descr string)
+	// StartProgress shows a new step in progress which transfers data.
+	StartProgress(step int8, descr string)
+	// Progress updates the number of bytes transferred by the current step.
+	Progress(done, total int64)
+	// Success marks the current step as succeeded.
+	Success(step int8, descr string)
+	// Fail marks the current step as failed and explains how to fix the issue.
+	Fail(step int8, descr, help string)
+	// Warn shows a warning which doesn't stop the workflow.
+	Warn(msg string)
+	// Log shows a log line of a Job run by the current step.
+	Log(source, line string)
+}
+
+// stepReporter prints each step of a single service workflow on its own line.
+type stepReporter struct {
+	spin *spinner.Spinner
+	bar  *ui.ProgressBar
+}
+
+func (r *stepReporter) Start(step int8, descr string) {
+	r.spin = ui.ShowSpinner(step, descr)
+}
+
+func (r *stepReporter) StartProgress(step int8, descr string) {
+	r.bar = ui.ShowProgress(step, descr)
+}
+
+func (r *stepReporter) Progress(done, total int64) {
+	if r.bar != nil {
+		r.bar.Update(done, total)
+	}
+}
+
+func (r *stepReporter) Success(step int8, descr string) {
+	if r.bar != nil {
+		ui.ProgressSuccess(step, descr, r.bar)
+		r.bar = nil
+		return
+	}
+	ui.SpinnerSuccess(step, descr, r.spin)
+}
+
+func (r *stepReporter) Fail(step int8, descr, help string) {
+	if r.bar != nil {
+		ui.ProgressFail(step, descr, r.bar)
+		r.bar = nil
+	} else {
+		ui.SpinnerFail(step, descr, r.spin)
+	}
+	ui.FailMessage(help)
+}
+
+func (r *stepReporter) Warn(msg string) {
+	ui.WarnMessage(msg)
+}
+
+func (r *stepReporter) Log(source, line string) {
+	// Log lines are printed above the spinner of the current step
+	if r.spin != nil {
+		r.spin.Stop()
+		defer r.spin.Start()
+	}
+	ui.LogLine(source, line)
+}
+
+// boardReporter shows the current step of a service on a shared status board
+// and keeps warnings and failure details to be printed once all services finish.
+type boardReporter struct {
+	board    *ui.StatusBoard
+	task     int
+	descr    string
+	last     string
+	help     string
+	warnings []string
+}
+
+func (r *boardReporter) Start(step int8, descr string) {
+	r.descr = fmt.Sprintf("Step %v: %v", step, descr)
+	r.board.Update(r.task, r.descr)
+}
+
+func (r *boardReporter) StartProgress(step int8, descr string) {
+	r.Start(step, descr)
+}
+
+func (r *boardReporter) Progress(done, total int64) {
+	status := fmt.Sprintf("%v %v", r.descr, humanize.Bytes(uint64(done)))
+	if total > 0 {
+		status = fmt.Sprintf("%v %d%%", r.descr, done*100/total)
+	}
+	r.board.Update(r.task, status)
+}
+
+func (r *boardReporter) Success(step int8, descr string) {
+	r.last = descr
+	r.board.Update(r.task, fmt.Sprintf("Step %v: %v", step, descr))
+}
+
+func (r *boardReporter) Fail(step int8, descr, help string) {
+	r.help = help
+	r.board.Fail(r.task, fmt.Sprintf("Step %v: %v", step, descr))
+}
+
+func (r *boardReporter) Warn(msg string) {
+	r.warnings = append(r.warnings, msg)
+}
+
+func (r *boardReporter) Log(source, line string) {
+	// Only the latest line is shown, cut so it doesn't wrap and break the board
+	status := fmt.Sprintf("%v [%v] %v", r.descr, source, line)
+	if runes := []rune(status); len(runes) > boardLogWidth {
+		status = string(runes[:boardLogWidth-3]) + "..."
+	}
+	r.board.Update(r.task, status)
+}
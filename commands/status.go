@@ -0,0 +1,223 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ajdnik/kube-cli/config"
+	"github.com/ajdnik/kube-cli/executable"
+	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+// How often the status is refreshed when watching.
+const statusRefresh = 2 * time.Second
+
+var watchStatus bool
+
+// StatusCommand shows the state of the workloads running the project.
+var StatusCommand = &cobra.Command{
+	Use:   "status [service...]",
+	Short: "Show deployment status",
+	Long: `Show the images, revision, replica counts, rollout conditions, pods
+and recent events of the workloads running the project.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spin := ui.ShowSpinner(1, "Reading configuration...")
+		// Get project root directory
+		cwd, err := executable.GetCwd()
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Please, retry 'kube-cli status' command.")
+			return err
+		}
+		// Get YAML config path in project root
+		cp, err := config.GetPath(cwd)
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Couldn't find kubecli YAML file in the project root. Try running 'kube-cli init' to create one.")
+			return err
+		}
+		// Parse project YAML config
+		cfg, err := config.Read(cp)
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage("Couldn't read kubecli YAML file. Try running 'kube-cli validate' to make sure the file is valid.")
+			return err
+		}
+		services, err := selectServices(cfg, args)
+		if err != nil {
+			ui.SpinnerFail(1, "There was a problem reading configuration.", spin)
+			ui.FailMessage(fmt.Sprintf("Couldn't select services, %v.", err))
+			return err
+		}
+		ui.SpinnerSuccess(1, "Successfully read configuration for project.", spin)
+		spin = ui.ShowSpinner(2, "Retrieving status...")
+		// Retrieve GKE cluster info
+		cls, err := web.GetGKECluster(cfg.Gke.Project, cfg.Gke.Zone, cfg.Gke.Cluster)
+		if err != nil {
+			ui.SpinnerFail(2, "There was a problem retrieving the status.", spin)
+			ui.FailMessage("Please, retry 'kube-cli status'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS.")
+			return err
+		}
+		var workloads []web.Workload
+		for _, svc := range services {
+			w, err := serviceWorkloads(cwd, cfg, svc, cls)
+			if err != nil {
+				ui.SpinnerFail(2, "There was a problem retrieving the status.", spin)
+				ui.FailMessage(workloadsFailMessage(svc, err))
+				return err
+			}
+			workloads = append(workloads, w...)
+		}
+		statuses, err := workloadStatuses(workloads, cls)
+		if err != nil {
+			ui.SpinnerFail(2, "There was a problem retrieving the status.", spin)
+			ui.FailMessage(statusFailMessage(cfg, err))
+			return err
+		}
+		ui.SpinnerSuccess(2, "Successfully retrieved the status.", spin)
+		if !watchStatus {
+			printStatuses(statuses)
+			return nil
+		}
+		// Redraw the status until the command is interrupted
+		for {
+			ui.ClearScreen()
+			ui.Message(fmt.Sprintf("Every %v, press Ctrl+C to stop.", statusRefresh))
+			printStatuses(statuses)
+			time.Sleep(statusRefresh)
+			statuses, err = workloadStatuses(workloads, cls)
+			if err != nil {
+				ui.FailMessage(statusFailMessage(cfg, err))
+				return err
+			}
+		}
+	},
+}
+
+// This function is only executed once after the package is imported.
+func init() {
+	StatusCommand.Flags().BoolVarP(&watchStatus, "watch", "w", false, "keep refreshing the status")
+}
+
+// Workloads which run the image of a service, either configured or defined by
+// its manifests or Helm chart.
+func serviceWorkloads(cwd string, cfg config.Data, svc config.ServiceData, cls web.ClusterInfo) ([]web.Workload, error) {
+	if hasHelmRelease(svc) {
+		rel, err := helmRelease(cwd, cfg, svc, "", svc.Docker.Tag, "")
+		if err != nil {
+			return nil, err
+		}
+		docs, err := web.RenderRelease(rel, cls)
+		if err != nil {
+			return nil, err
+		}
+		return documentWorkloads(docs, rel.Namespace)
+	}
+	if hasManifests(svc) {
+		return manifestWorkloads(cwd, cfg, svc)
+	}
+	return targetWorkloads(svc.Deployment), nil
+}
+
+// Describe why the workloads of a service couldn't be found and how to fix it.
+func workloadsFailMessage(svc config.ServiceData, err error) string {
+	if hasHelmRelease(svc) {
+		return fmt.Sprintf("Couldn't render Helm release '%v': %v. Fix the release section of kubecli.yaml or the chart and rerun the command.", helmReleaseName(svc), err)
+	}
+	return manifestFailMessage(err)
+}
+
+// Retrieve the status of each workload.
+func workloadStatuses(workloads []web.Workload, cls web.ClusterInfo) ([]web.WorkloadStatus, error) {
+	var statuses []web.WorkloadStatus
+	for _, w := range workloads {
+		st, err := web.GetWorkloadStatus(w, cls)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// Describe why the status couldn't be retrieved and how to fix it.
+func statusFailMessage(cfg config.Data, err error) string {
+	if e, ok := err.(*web.NotFoundError); ok {
+		return fmt.Sprintf("Couldn't find %v '%v' in '%v' namespace in cluster '%v'. Run 'kube-cli deploy' to create it.", e.Kind, e.Name, e.Namespace, cfg.Gke.Cluster)
+	}
+	return "Please, retry 'kube-cli status'. Make sure you have an active internet connection and 'Kubernetes Engine Admin' permissions on GCP Service Account defined in GOOGLE_APPLICATION_CREDENTIALS."
+}
+
+// Print the status of workloads.
+func printStatuses(statuses []web.WorkloadStatus) {
+	for i, st := range statuses {
+		if i > 0 {
+			ui.Message("")
+		}
+		printStatus(st)
+	}
+}
+
+// Print the status of a workload.
+func printStatus(st web.WorkloadStatus) {
+	w := st.Workload
+	ui.Message(fmt.Sprintf("%v '%v' in '%v' namespace", w.Kind, w.Name, w.Namespace))
+	if len(st.Revision) > 0 {
+		ui.Message(fmt.Sprintf("  Revision:   %v", st.Revision))
+	}
+	ui.Message(fmt.Sprintf("  Replicas:   %v desired, %v updated, %v ready, %v available", st.Desired, st.Updated, st.Ready, st.Available))
+	for _, img := range st.Images {
+		name := img.Container
+		if img.Init {
+			name += " (init)"
+		}
+		ui.Message(fmt.Sprintf("  Image:      %v %v", name, img.Image))
+	}
+	for _, c := range st.Conditions {
+		msg := fmt.Sprintf("  Condition:  %v=%v", c.Type, c.Status)
+		if len(c.Reason) > 0 {
+			msg += fmt.Sprintf(" (%v)", c.Reason)
+		}
+		ui.Message(msg)
+	}
+	if len(st.Pods) == 0 {
+		ui.Message("  Pods:       none")
+	} else {
+		ui.Message("  Pods:")
+		var rows []string
+		rows = append(rows, "NAME\tSTATUS\tREADY\tRESTARTS\tAGE")
+		for _, p := range st.Pods {
+			rows = append(rows, fmt.Sprintf("%v\t%v\t%v/%v\t%v\t%v", p.Name, p.Status, p.Ready, p.Containers, p.Restarts, humanize.Time(p.Created)))
+		}
+		printTable(rows)
+	}
+	if len(st.Events) > 0 {
+		ui.Message("  Events:")
+		var rows []string
+		for _, e := range st.Events {
+			count := ""
+			if e.Count > 1 {
+				count = fmt.Sprintf(" (x%v)", e.Count)
+			}
+			rows = append(rows, fmt.Sprintf("%v\t%v\t%v\t%v%v", humanize.Time(e.Last), e.Type, e.Reason, e.Message, count))
+		}
+		printTable(rows)
+	}
+}
+
+// Print tab separated rows as aligned columns, indented under a status heading.
+func printTable(rows []string) {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, r := range rows {
+		fmt.Fprintln(tw, "    "+r)
+	}
+	tw.Flush()
+	ui.Message(strings.TrimRight(buf.String(), "\n"))
+}
@@ -49,23 +49,27 @@ version from the web. Make sure you have an active web connection.`,
 			ui.SuccessMessage("The CLI tool is already updated to the latest version.")
 			return nil
 		}
-		spin = ui.ShowSpinner(2, "Downloading CLI archive...")
+		bar := ui.ShowProgress(2, "Downloading CLI archive...")
 		// Create temp file for downloaded archive
 		tarTemp, err := filesystem.CreateTemp()
 		if err != nil {
-			ui.SpinnerFail(2, "There was a problem downloading CLI archive.", spin)
+			ui.ProgressFail(2, "There was a problem downloading CLI archive.", bar)
 			ui.FailMessage("Please, retry 'kube-cli update' command as an administrator.")
 			return err
 		}
+		defer os.Remove(tarTemp)
 		// Download latest CLI archive
-		sz, err := web.DownloadFile(tarTemp, release.TarURL)
+		sz, err := web.DownloadFile(tarTemp, release.TarURL, bar.Update)
 		if err != nil {
-			ui.SpinnerFail(2, "There was a problem downloading CLI archive.", spin)
-			ui.FailMessage("Please, retry 'kube-cli update' command as an administrator.")
+			ui.ProgressFail(2, "There was a problem downloading CLI archive.", bar)
+			if serr, ok := err.(*web.StatusError); ok {
+				ui.FailMessage(fmt.Sprintf("Please, retry 'kube-cli update' command. The release server responded with status %v.", serr.StatusCode))
+				return err
+			}
+			ui.FailMessage("Please, retry 'kube-cli update' command. Make sure you have an active internet connection and your proxy settings in HTTPS_PROXY are correct.")
 			return err
 		}
-		defer os.Remove(tarTemp)
-		ui.SpinnerSuccess(2, fmt.Sprintf("Downloaded CLI archive %s.", humanize.Bytes(uint64(sz))), spin)
+		ui.ProgressSuccess(2, fmt.Sprintf("Downloaded CLI archive %s.", humanize.Bytes(uint64(sz))), bar)
 		// Download SHA512 sum file
 		spin = ui.ShowSpinner(3, "Verifying downloaded archive...")
 		// Create temp file for downloaded hash file
@@ -75,14 +79,14 @@ version from the web. Make sure you have an active web connection.`,
 			ui.FailMessage("Please, retry 'kube-cli update' command as an administrator.")
 			return err
 		}
+		defer os.Remove(shaTemp)
 		// Download archive hash
-		sz, err = web.DownloadFile(shaTemp, release.ShaURL)
+		_, err = web.DownloadFile(shaTemp, release.ShaURL, nil)
 		if err != nil {
 			ui.SpinnerFail(3, "There was a problem verifying the downloaded archive.", spin)
-			ui.FailMessage("Please, retry 'kube-cli update' command as an administrator.")
+			ui.FailMessage("Please, retry 'kube-cli update' command. Make sure you have an active internet connection.")
 			return err
 		}
-		defer os.Remove(shaTemp)
 		// Extract downloaded hash from file
 		dSum, err := extractSum(shaTemp)
 		if err != nil {
@@ -1,14 +1,20 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/ajdnik/kube-cli/config"
 	"github.com/ajdnik/kube-cli/executable"
 	"github.com/ajdnik/kube-cli/filesystem"
 	"github.com/ajdnik/kube-cli/ui"
+	"github.com/ajdnik/kube-cli/web"
 	"github.com/spf13/cobra"
 )
 
@@ -29,11 +35,6 @@ the properties and structure is correct.`,
 			ui.FailMessage("Please, retry 'kube-cli init' command.")
 			return err
 		}
-		// Verify Dockerfile exists in project root
-		df := filepath.Join(cwd, "Dockerfile")
-		if !filesystem.FileExists(df) {
-			ui.WarnMessage("Couldn't find Dockerfile in the project root. See https://docs.docker.com/engine/reference/builder/ for further info.")
-		}
 		// Get YAML config path in project root
 		cp, err := config.GetPath(cwd)
 		if err != nil {
@@ -46,9 +47,9 @@ the properties and structure is correct.`,
 			ui.FailMessage(strings.Replace(err.Error(), "yaml:", "YAML sytnax is incorrect on", 1))
 			return err
 		}
+		hasInvalid := false
 		// Validate each property
 		err = validDashName(cfg.Gke.Project)
-		hasInvalid := false
 		if err != nil {
 			ui.FailMessage(fmt.Sprintf("GKE Project %v", err.Error()))
 			hasInvalid = true
@@ -62,40 +63,271 @@ the properties and structure is correct.`,
 			ui.FailMessage("GKE Zone is not a valid zone string. See https://cloud.google.com/compute/docs/regions-zones/ for more info.")
 			hasInvalid = true
 		}
-		err = validDashName(cfg.Docker.Name)
-		if err != nil {
-			ui.FailMessage(fmt.Sprintf("Docker Name %v", err.Error()))
+		// Validate each service, services are prefixed with their names in messages
+		names := make(map[string]bool)
+		for _, svc := range cfg.AllServices() {
+			prefix := ""
+			if len(cfg.Services) > 0 {
+				prefix = fmt.Sprintf("Service %v: ", svc.Name)
+				if err := validDashName(svc.Name); err != nil {
+					ui.FailMessage(fmt.Sprintf("Service Name %v", err.Error()))
+					hasInvalid = true
+				} else if names[svc.Name] {
+					ui.FailMessage(fmt.Sprintf("Service Name %v is defined more than once.", svc.Name))
+					hasInvalid = true
+				}
+				names[svc.Name] = true
+			}
+			if !validService(cwd, svc, prefix) {
+				hasInvalid = true
+			}
+		}
+		if len(cfg.Build.Bucket) > 0 && !validBucketName.MatchString(cfg.Build.Bucket) {
+			ui.FailMessage("Build Bucket must be 3 to 63 lowercase letters, numbers, dashes, underscores and dots, starting and ending with a letter or number. See https://cloud.google.com/storage/docs/naming for more info.")
 			hasInvalid = true
 		}
-		err = validDashName(cfg.Docker.Tag)
-		if err != nil {
-			ui.FailMessage(fmt.Sprintf("Docker Tag %v", err.Error()))
+		if len(cfg.Build.KMSKey) > 0 && !validKMSKey.MatchString(cfg.Build.KMSKey) {
+			ui.FailMessage("Build KMS Key must be a key resource name in the 'projects/PROJECT/locations/LOCATION/keyRings/RING/cryptoKeys/KEY' format.")
 			hasInvalid = true
 		}
-		err = validDashName(cfg.Deployment.Name)
-		if err != nil {
-			ui.FailMessage(fmt.Sprintf("Deployment Name %v", err.Error()))
+		if len(cfg.Build.Symlinks) > 0 && !linearSearch(cfg.Build.Symlinks, []string{"keep", "copy", "reject"}) {
+			ui.FailMessage("Build Symlinks must be one of 'keep', 'copy' or 'reject'.")
 			hasInvalid = true
 		}
-		err = validDashName(cfg.Deployment.Namespace)
-		if err != nil {
-			ui.FailMessage(fmt.Sprintf("Deployment Namespace %v", err.Error()))
+		if _, err := maxFileSize(cfg); err != nil {
+			ui.FailMessage("Build Max File Size must be a size like '10MB' or '1.5GB'.")
 			hasInvalid = true
 		}
-		err = validDashName(cfg.Deployment.Container.Name)
-		if err != nil {
-			ui.FailMessage(fmt.Sprintf("Container Name %v", err.Error()))
+		if cfg.Build.RetentionDays < 0 {
+			ui.FailMessage("Build Retention Days must be a positive number of days or zero to keep source archives forever.")
 			hasInvalid = true
 		}
 		if hasInvalid {
 			ui.FailMessage("YAML configuration is invalid. Try running 'kube-cli init' to fix it.")
-			return err
+			return errors.New("invalid YAML configuration")
 		}
 		ui.SuccessMessage("YAML configuration is valid.")
 		return nil
 	},
 }
 
+// Validate the Docker and deployment properties of a service, messages are prefixed with prefix.
+func validService(cwd string, svc config.ServiceData, prefix string) bool {
+	valid := true
+	// Verify Dockerfile exists inside of the build context
+	if stat, err := os.Stat(contextDir(cwd, svc.Docker)); err != nil || !stat.IsDir() {
+		ui.FailMessage(fmt.Sprintf("%vDocker Context %v is not a directory.", prefix, contextDir(cwd, svc.Docker)))
+		valid = false
+	} else if _, err := contextDockerfile(cwd, svc.Docker); err != nil {
+		ui.FailMessage(fmt.Sprintf("%vDockerfile %v must be inside of the build context %v.", prefix, dockerfilePath(cwd, svc.Docker), contextDir(cwd, svc.Docker)))
+		valid = false
+	} else if !filesystem.FileExists(dockerfilePath(cwd, svc.Docker)) {
+		ui.WarnMessage(fmt.Sprintf("%vCouldn't find Dockerfile at %v. See https://docs.docker.com/engine/reference/builder/ for further info.", prefix, dockerfilePath(cwd, svc.Docker)))
+	}
+	if len(svc.Manifests.Dir) > 0 {
+		dir := filepath.Join(cwd, svc.Manifests.Dir)
+		if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+			ui.FailMessage(fmt.Sprintf("%vManifests Dir %v is not a directory.", prefix, dir))
+			valid = false
+		}
+	}
+	if len(svc.Manifests.Kustomize) > 0 {
+		dir := filepath.Join(cwd, svc.Manifests.Kustomize)
+		if !kustomizationExists(dir) {
+			ui.FailMessage(fmt.Sprintf("%vManifests Kustomize %v doesn't contain a kustomization file.", prefix, dir))
+			valid = false
+		}
+	}
+	if len(svc.Manifests.Dir) > 0 && len(svc.Manifests.Kustomize) > 0 {
+		ui.FailMessage(fmt.Sprintf("%vManifests Dir and Kustomize can't be used together.", prefix))
+		valid = false
+	}
+	if hasManifests(svc) && len(svc.Manifests.Namespace) > 0 {
+		if err := validDashName(svc.Manifests.Namespace); err != nil {
+			ui.FailMessage(fmt.Sprintf("%vManifests Namespace %v", prefix, err.Error()))
+			valid = false
+		}
+	}
+	if hasHelmRelease(svc) {
+		if !filesystem.FileExists(filepath.Join(cwd, svc.Release.Helm.Chart)) {
+			ui.FailMessage(fmt.Sprintf("%vHelm Chart %v doesn't exist.", prefix, filepath.Join(cwd, svc.Release.Helm.Chart)))
+			valid = false
+		}
+		if err := validDashName(helmReleaseName(svc)); err != nil {
+			ui.FailMessage(fmt.Sprintf("%vHelm Release Name %v", prefix, err.Error()))
+			valid = false
+		}
+		files := svc.Release.Helm.Values
+		for _, env := range svc.Release.Helm.Environments {
+			files = append(files[:len(files):len(files)], env...)
+		}
+		for _, f := range files {
+			if !filesystem.FileExists(filepath.Join(cwd, f)) {
+				ui.FailMessage(fmt.Sprintf("%vHelm Values file %v doesn't exist.", prefix, filepath.Join(cwd, f)))
+				valid = false
+			}
+		}
+		if _, err := helmTimeout(svc); err != nil {
+			ui.FailMessage(fmt.Sprintf("%vHelm Timeout must be a duration like '5m'.", prefix))
+			valid = false
+		}
+		if hasManifests(svc) {
+			ui.FailMessage(fmt.Sprintf("%vHelm release and manifests can't be used together.", prefix))
+			valid = false
+		}
+	}
+	err := validDashName(svc.Docker.Name)
+	if err != nil {
+		ui.FailMessage(fmt.Sprintf("%vDocker Name %v", prefix, err.Error()))
+		valid = false
+	}
+	err = validDashName(svc.Docker.Tag)
+	if err != nil {
+		ui.FailMessage(fmt.Sprintf("%vDocker Tag %v", prefix, err.Error()))
+		valid = false
+	}
+	for _, k := range sortedKeys(svc.Env) {
+		if !validEnvName.MatchString(k) {
+			ui.FailMessage(fmt.Sprintf("%vEnv %v must consist of letters, digits and underscores and can't start with a digit.", prefix, k))
+			valid = false
+		}
+	}
+	var secrets []string
+	for _, sec := range svc.Secrets {
+		if !validEnvName.MatchString(sec.Name) {
+			ui.FailMessage(fmt.Sprintf("%vSecret Name %v must consist of letters, digits and underscores and can't start with a digit.", prefix, sec.Name))
+			valid = false
+		}
+		if linearSearch(sec.Name, secrets) {
+			ui.FailMessage(fmt.Sprintf("%vSecret Name %v is defined more than once.", prefix, sec.Name))
+			valid = false
+		}
+		secrets = append(secrets, sec.Name)
+		if !validSecretID.MatchString(secretID(sec)) {
+			ui.FailMessage(fmt.Sprintf("%vSecret %v must consist of at most 255 letters, digits, dashes and underscores.", prefix, secretID(sec)))
+			valid = false
+		}
+		if !validSecretVersion.MatchString(secretVersion(sec)) {
+			ui.FailMessage(fmt.Sprintf("%vSecret Version %v must be latest or a version number.", prefix, sec.Version))
+			valid = false
+		}
+	}
+	// Hook names are part of Job names, so they're unique across both stages
+	var hooks []string
+	all := append([]config.HookData{}, svc.Hooks.PreDeploy...)
+	for _, h := range append(all, svc.Hooks.PostDeploy...) {
+		if err := validDashName(h.Name); err != nil {
+			ui.FailMessage(fmt.Sprintf("%vHook Name %v", prefix, err.Error()))
+			valid = false
+		} else if len(hookJobName(svc, h, fmt.Sprintf("%v", time.Now().Unix()))) > maxJobName {
+			ui.FailMessage(fmt.Sprintf("%vHook Name %v is too long, Job names made of the service name, hook name and deploy timestamp can't exceed %v characters.", prefix, h.Name, maxJobName))
+			valid = false
+		}
+		if linearSearch(h.Name, hooks) {
+			ui.FailMessage(fmt.Sprintf("%vHook Name %v is defined more than once.", prefix, h.Name))
+			valid = false
+		}
+		hooks = append(hooks, h.Name)
+		if len(h.Command) == 0 {
+			ui.FailMessage(fmt.Sprintf("%vHook %v Command must be set.", prefix, h.Name))
+			valid = false
+		}
+		if timeout, err := hookTimeout(h); err != nil || timeout < time.Second {
+			ui.FailMessage(fmt.Sprintf("%vHook %v Timeout must be a duration like '10m'.", prefix, h.Name))
+			valid = false
+		}
+	}
+	// Manifests and Helm releases replace the deployment subsection, unless it's also set
+	if (hasManifests(svc) || hasHelmRelease(svc)) && len(svc.Deployment.Name) == 0 {
+		return valid
+	}
+	err = validDashName(svc.Deployment.Name)
+	if err != nil {
+		ui.FailMessage(fmt.Sprintf("%vDeployment Name %v", prefix, err.Error()))
+		valid = false
+	}
+	err = validDashName(svc.Deployment.Namespace)
+	if err != nil {
+		ui.FailMessage(fmt.Sprintf("%vDeployment Namespace %v", prefix, err.Error()))
+		valid = false
+	}
+	if len(svc.Deployment.Kind) > 0 && !linearSearch(svc.Deployment.Kind, web.WorkloadKinds) {
+		ui.FailMessage(fmt.Sprintf("%vDeployment Kind must be one of %v.", prefix, strings.Join(web.WorkloadKinds, ", ")))
+		valid = false
+	}
+	for _, c := range svc.Deployment.AllContainers() {
+		err = validDashName(c.Name)
+		if err != nil {
+			ui.FailMessage(fmt.Sprintf("%vContainer Name %v", prefix, err.Error()))
+			valid = false
+		}
+	}
+	for _, t := range svc.Deployment.Targets {
+		if len(t.Kind) > 0 && !linearSearch(t.Kind, web.WorkloadKinds) {
+			ui.FailMessage(fmt.Sprintf("%vTarget Kind must be one of %v.", prefix, strings.Join(web.WorkloadKinds, ", ")))
+			valid = false
+		}
+		err = validDashName(t.Name)
+		if err != nil {
+			ui.FailMessage(fmt.Sprintf("%vTarget Name %v", prefix, err.Error()))
+			valid = false
+		}
+		if len(t.Namespace) > 0 {
+			err = validDashName(t.Namespace)
+			if err != nil {
+				ui.FailMessage(fmt.Sprintf("%vTarget Namespace %v", prefix, err.Error()))
+				valid = false
+			}
+		}
+		for _, c := range t.Containers {
+			err = validDashName(c.Name)
+			if err != nil {
+				ui.FailMessage(fmt.Sprintf("%vTarget Container Name %v", prefix, err.Error()))
+				valid = false
+			}
+		}
+	}
+	return valid
+}
+
+// Check if a directory contains a kustomization file.
+func kustomizationExists(dir string) bool {
+	for _, name := range []string{"kustomization.yaml", "kustomization.yml", "Kustomization"} {
+		if filesystem.FileExists(filepath.Join(dir, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Google Storage bucket naming rules, see https://cloud.google.com/storage/docs/naming.
+var validBucketName = regexp.MustCompile("^[a-z0-9][a-z0-9_.-]{1,61}[a-z0-9]$")
+
+// Cloud KMS crypto key resource name.
+var validKMSKey = regexp.MustCompile("^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$")
+
+// Environment variable names which can be loaded from a ConfigMap.
+var validEnvName = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// Secret Manager secret ids.
+var validSecretID = regexp.MustCompile("^[A-Za-z0-9_-]{1,255}$")
+
+// Secret Manager versions, either latest or a version number.
+var validSecretVersion = regexp.MustCompile("^(latest|[1-9][0-9]*)$")
+
+// Maximum length of Job names, which are used as label values of their pods.
+const maxJobName = 63
+
+// Keys of a map in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Linear search through a slice of strings.
 func linearSearch(item string, arr []string) bool {
 	for _, s := range arr {
@@ -13,8 +13,59 @@ import (
 // Data represents the configuration structure of kubecli.yaml file.
 type Data struct {
 	Gke        GKEData
+	Docker     DockerData        `yaml:",omitempty"`
+	Deployment DeploymentData    `yaml:",omitempty"`
+	Manifests  ManifestsData     `yaml:",omitempty"`
+	Release    ReleaseData       `yaml:",omitempty"`
+	Build      BuildData         `yaml:",omitempty"`
+	Env        map[string]string `yaml:",omitempty"`
+	Secrets    []SecretData      `yaml:",omitempty"`
+	Hooks      HooksData         `yaml:",omitempty"`
+	Services   []ServiceData     `yaml:",omitempty"`
+}
+
+// ServiceData represents an entry of the services subsection of the kubecli.yaml
+// file, used instead of the docker and deployment subsections in monorepos.
+type ServiceData struct {
+	Name       string
 	Docker     DockerData
-	Deployment DeploymentData
+	Deployment DeploymentData    `yaml:",omitempty"`
+	Manifests  ManifestsData     `yaml:",omitempty"`
+	Release    ReleaseData       `yaml:",omitempty"`
+	Env        map[string]string `yaml:",omitempty"`
+	Secrets    []SecretData      `yaml:",omitempty"`
+	Hooks      HooksData         `yaml:",omitempty"`
+}
+
+// SecretData represents an entry of the secrets subsection of the kubecli.yaml
+// file, a GCP Secret Manager secret loaded into the deployed containers.
+type SecretData struct {
+	// Name of the environment variable with the secret value.
+	Name string
+	// Name of the secret in Secret Manager, defaults to the variable name.
+	Secret string `yaml:",omitempty"`
+	// Version of the secret, defaults to the latest version.
+	Version string `yaml:",omitempty"`
+}
+
+// HooksData represents the hooks subsection of the kubecli.yaml file, Jobs
+// running the built image before and after the deploy.
+type HooksData struct {
+	// Run before workloads are updated, like database migrations.
+	PreDeploy []HookData `yaml:"preDeploy,omitempty"`
+	// Run after the rollout completes, like smoke tests.
+	PostDeploy []HookData `yaml:"postDeploy,omitempty"`
+	// Roll back the deploy when a post-deploy hook fails.
+	Rollback bool `yaml:",omitempty"`
+}
+
+// HookData represents an entry of the preDeploy and postDeploy subsections of
+// the hooks subsection of the kubecli.yaml file.
+type HookData struct {
+	Name    string
+	Command []string
+	// How long the Job can run before it fails, defaults to 10m.
+	Timeout string `yaml:",omitempty"`
 }
 
 // GKEData represents the gke subsection of the kubecli.yaml file.
@@ -22,24 +73,162 @@ type GKEData struct {
 	Project string
 	Zone    string
 	Cluster string
+	// Commands which change workloads outside of a deploy ask for confirmation on protected clusters.
+	Protected bool `yaml:",omitempty"`
 }
 
 // DockerData represents the docker subsection of the kubecli.yaml file.
 type DockerData struct {
 	Name string
 	Tag  string
+	// Build context directory relative to the project root, defaults to the project root.
+	Context string `yaml:",omitempty"`
+	// Dockerfile path relative to the project root, defaults to Dockerfile in the build context.
+	Dockerfile string `yaml:",omitempty"`
+}
+
+// BuildData represents the build subsection of the kubecli.yaml file.
+type BuildData struct {
+	// Name of the bucket where source archives are uploaded,
+	// defaults to '<project>-cloudbuild'.
+	Bucket string `yaml:",omitempty"`
+	// Location of the bucket when it's created by kube-cli.
+	BucketLocation string `yaml:"bucketLocation,omitempty"`
+	// Cloud KMS key used to encrypt source archives when the bucket is created by kube-cli.
+	KMSKey string `yaml:"kmsKey,omitempty"`
+	// Size above which files in the build context are reported, like 10MB.
+	MaxFileSize string `yaml:"maxFileSize,omitempty"`
+	// How symlinks pointing outside of the project are archived, one of
+	// keep, copy or reject. Defaults to keep, like docker build.
+	Symlinks string `yaml:",omitempty"`
+	// Number of days after which source archives are deleted from the bucket,
+	// zero keeps them forever.
+	RetentionDays int `yaml:"retentionDays,omitempty"`
 }
 
 // DeploymentData represents the deployment subsection of the kubecli.yaml file.
 type DeploymentData struct {
+	// One of Deployment, StatefulSet, DaemonSet, CronJob or Job, defaults to Deployment.
+	Kind      string `yaml:",omitempty"`
 	Name      string
 	Namespace string
-	Container ContainerData
+	Container ContainerData `yaml:",omitempty"`
+	// Containers and init containers updated with the new image, used
+	// instead of container when the pod runs the image more than once.
+	Containers []ContainerData `yaml:",omitempty"`
+	// Other workloads running the same image, updated together with this one.
+	Targets []TargetData `yaml:",omitempty"`
+}
+
+// ManifestsData represents the manifests subsection of the kubecli.yaml file.
+type ManifestsData struct {
+	// Directory with Kubernetes manifest templates relative to the project root,
+	// applied instead of updating the deployment image when set.
+	Dir string `yaml:",omitempty"`
+	// Kustomization directory relative to the project root, like an overlay,
+	// built and applied instead of the templates in dir when set.
+	Kustomize string `yaml:",omitempty"`
+	// Namespace of objects which don't set one, defaults to the deployment namespace.
+	Namespace string `yaml:",omitempty"`
+	// Values available to manifest templates.
+	Values map[string]string `yaml:",omitempty"`
+}
+
+// ReleaseData represents the release subsection of the kubecli.yaml file.
+type ReleaseData struct {
+	Helm HelmData `yaml:",omitempty"`
+}
+
+// HelmData represents the helm subsection of the release subsection of the kubecli.yaml file.
+type HelmData struct {
+	// Chart directory or archive relative to the project root, the release is
+	// installed or upgraded instead of updating the deployment image when set.
+	Chart string `yaml:",omitempty"`
+	// Release name, defaults to the service name.
+	Name string `yaml:",omitempty"`
+	// Release namespace, defaults to the deployment namespace.
+	Namespace string `yaml:",omitempty"`
+	// Values files relative to the project root used in every environment.
+	Values []string `yaml:",omitempty"`
+	// Values files used on top of values in each environment.
+	Environments map[string][]string `yaml:",omitempty"`
+	// Value set to the image repository, defaults to image.repository.
+	ImageRepository string `yaml:"imageRepository,omitempty"`
+	// Value set to the image tag, defaults to image.tag.
+	ImageTag string `yaml:"imageTag,omitempty"`
+	// How long to wait for release resources to be ready, defaults to 5m.
+	Timeout string `yaml:",omitempty"`
 }
 
 // ContainerData represents the container subsection of the kubecli.yaml file.
 type ContainerData struct {
 	Name string
+	// Set when the container is an init container.
+	Init bool `yaml:",omitempty"`
+}
+
+// TargetData represents an entry of the targets subsection of the kubecli.yaml file.
+type TargetData struct {
+	// Defaults to Deployment.
+	Kind string `yaml:",omitempty"`
+	Name string
+	// Defaults to the deployment namespace.
+	Namespace string `yaml:",omitempty"`
+	// Defaults to the deployment containers.
+	Containers []ContainerData `yaml:",omitempty"`
+}
+
+// AllServices returns the services defined in the services subsection or,
+// when it's empty, a single service defined by the docker and deployment
+// subsections and named after the Docker image.
+func (d Data) AllServices() []ServiceData {
+	if len(d.Services) > 0 {
+		return d.Services
+	}
+	return []ServiceData{
+		{
+			Name:       d.Docker.Name,
+			Docker:     d.Docker,
+			Deployment: d.Deployment,
+			Manifests:  d.Manifests,
+			Release:    d.Release,
+			Env:        d.Env,
+			Secrets:    d.Secrets,
+			Hooks:      d.Hooks,
+		},
+	}
+}
+
+// AllContainers returns the containers defined in the containers subsection
+// or, when it's empty, the container defined by the container subsection.
+func (d DeploymentData) AllContainers() []ContainerData {
+	if len(d.Containers) > 0 {
+		return d.Containers
+	}
+	return []ContainerData{d.Container}
+}
+
+// AllTargets returns the deployment itself followed by the other targets,
+// with namespaces and containers defaulting to those of the deployment.
+func (d DeploymentData) AllTargets() []TargetData {
+	targets := []TargetData{
+		{
+			Kind:       d.Kind,
+			Name:       d.Name,
+			Namespace:  d.Namespace,
+			Containers: d.AllContainers(),
+		},
+	}
+	for _, t := range d.Targets {
+		if len(t.Namespace) == 0 {
+			t.Namespace = d.Namespace
+		}
+		if len(t.Containers) == 0 {
+			t.Containers = d.AllContainers()
+		}
+		targets = append(targets, t)
+	}
+	return targets
 }
 
 // Read kubecli.yaml file and parse it.
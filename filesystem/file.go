@@ -1,10 +1,17 @@
 package filesystem
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 )
 
+// IgnoreFunc reports whether a path found while walking a directory should be
+// skipped. Skipping a directory skips everything inside of it.
+type IgnoreFunc func(path string, dir bool) (bool, error)
+
 // FileExists checks if a file exists on the filesystem.
 func FileExists(path string) bool {
 	if _, err := os.Stat(path); err != nil {
@@ -15,15 +22,97 @@ func FileExists(path string) bool {
 	return true
 }
 
-// Glob returns a list of all files within a directory.
-func Glob(dir string) ([]string, error) {
+// Glob returns a list of all files, directories and symlinks within a directory
+// which aren't ignored. Ignored directories are not walked.
+func Glob(dir string, ignore IgnoreFunc) ([]string, error) {
 	files := []string{}
 	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-		if f.IsDir() {
+		// The root directory is never ignored
+		if path == dir {
+			return err
+		}
+		isDir := f != nil && f.IsDir()
+		skip, ierr := ignore(path, isDir)
+		if ierr != nil {
+			return ierr
+		}
+		if skip {
+			if isDir {
+				return filepath.SkipDir
+			}
 			return nil
 		}
+		// Errors of paths that aren't ignored can't be recovered from
+		if err != nil {
+			return err
+		}
 		files = append(files, path)
 		return nil
 	})
 	return files, err
 }
+
+// GlobParallel works like Glob, but reads up to the given number of
+// directories concurrently. The returned files are sorted.
+func GlobParallel(dir string, ignore IgnoreFunc, workers int) ([]string, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var werr error
+	files := []string{}
+	sem := make(chan struct{}, workers)
+	// Keep the first error that occurs
+	fail := func(err error) {
+		mu.Lock()
+		if werr == nil {
+			werr = err
+		}
+		mu.Unlock()
+	}
+	// Once an error occurred the remaining directories aren't read
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return werr != nil
+	}
+	var walk func(d string)
+	walk = func(d string) {
+		defer wg.Done()
+		sem <- struct{}{}
+		if failed() {
+			<-sem
+			return
+		}
+		entries, err := ioutil.ReadDir(d)
+		<-sem
+		if err != nil {
+			fail(err)
+			return
+		}
+		for _, e := range entries {
+			if failed() {
+				return
+			}
+			path := filepath.Join(d, e.Name())
+			skip, err := ignore(path, e.IsDir())
+			if err != nil {
+				fail(err)
+				return
+			}
+			if skip {
+				continue
+			}
+			mu.Lock()
+			files = append(files, path)
+			mu.Unlock()
+			if e.IsDir() {
+				wg.Add(1)
+				go walk(path)
+			}
+		}
+	}
+	wg.Add(1)
+	go walk(dir)
+	wg.Wait()
+	sort.Strings(files)
+	return files, werr
+}
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 )
 
+// Length is the number of hex characters of the sums returned by this package.
+const Length = sha512.Size * 2
+
 // Sum returns a SHA512 sum of a file.
 func Sum(file string) (string, error) {
 	var sum string
@@ -15,10 +19,30 @@ func Sum(file string) (string, error) {
 		return sum, err
 	}
 	defer f.Close()
+	return SumReader(f)
+}
+
+// SumReader returns a SHA512 sum of all data read from a reader.
+func SumReader(r io.Reader) (string, error) {
+	var sum string
 	h := sha512.New()
-	if _, err := io.Copy(h, f); err != nil {
+	if _, err := io.Copy(h, r); err != nil {
 		return sum, err
 	}
 	sum = fmt.Sprintf("%x", h.Sum(nil))
 	return sum, nil
 }
+
+// SumValues returns a SHA512 sum of key value pairs, which doesn't depend on their order.
+func SumValues(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha512.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%v=%q\n", k, values[k])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -25,7 +25,23 @@ func main() {
 	root.AddCommand(commands.InitCommand)
 	root.AddCommand(commands.ValidateCommand)
 	root.AddCommand(commands.RollbackCommand)
+	root.AddCommand(commands.GCCommand)
+	root.AddCommand(commands.ContextCommand)
+	root.AddCommand(commands.DiffCommand)
+	root.AddCommand(commands.StatusCommand)
+	root.AddCommand(commands.LogsCommand)
+	root.AddCommand(commands.ExecCommand)
+	root.AddCommand(commands.PortForwardCommand)
+	root.AddCommand(commands.ScaleCommand)
+	root.AddCommand(commands.RestartCommand)
+	root.AddCommand(commands.PauseCommand)
+	root.AddCommand(commands.ResumeCommand)
+	root.AddCommand(commands.EnvCommand)
+	root.AddCommand(commands.SecretsCommand)
 	if err := root.Execute(); err != nil {
+		if e, ok := err.(*commands.ExitError); ok {
+			os.Exit(e.Code)
+		}
 		os.Exit(1)
 	}
 }
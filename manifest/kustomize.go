@@ -0,0 +1,66 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// Image replaces a docker image in kustomize resources, like an entry of the
+// images field of a kustomization file.
+type Image struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+}
+
+// kustomization is a kustomization file which replaces images of its resources.
+type kustomization struct {
+	Resources []string `yaml:"resources"`
+	Images    []Image  `yaml:"images,omitempty"`
+}
+
+// Kustomize builds a kustomization directory like kustomize build does, replaces
+// images in the result and splits it into documents.
+func Kustomize(dir string, images []Image) ([]Document, error) {
+	// A kustomization in a temporary directory adds the images on top of
+	// the given one without changing project files
+	tmp, err := ioutil.TempDir(os.TempDir(), "kube-cli-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Kustomize only accepts relative resource paths
+	rel, err := filepath.Rel(tmp, abs)
+	if err != nil {
+		return nil, err
+	}
+	b, err := yaml.Marshal(kustomization{
+		Resources: []string{filepath.ToSlash(rel)},
+		Images:    images,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(filepath.Join(tmp, "kustomization.yaml"), b, 0644)
+	if err != nil {
+		return nil, err
+	}
+	res, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(filesys.MakeFsOnDisk(), tmp)
+	if err != nil {
+		return nil, &TemplateError{File: dir, Err: err}
+	}
+	out, err := res.AsYaml()
+	if err != nil {
+		return nil, &TemplateError{File: dir, Err: err}
+	}
+	return Split(dir, out), nil
+}
@@ -0,0 +1,138 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Lines separating documents in a YAML file.
+var separator = regexp.MustCompile(`(?m)^---[ \t]*(#.*)?$`)
+
+// Data is passed to manifest templates.
+type Data struct {
+	// Full reference of the built docker image, like gcr.io/project/name:tag.
+	Image string
+	// Tag of the built docker image.
+	Tag       string
+	Service   string
+	Project   string
+	Namespace string
+	// Values from the manifests subsection of the kubecli.yaml file.
+	Values map[string]string
+	// ConfigMap with the env section of the kubecli.yaml file and its checksum,
+	// empty when the section isn't defined.
+	EnvConfigMap string
+	EnvChecksum  string
+	// Secret with the secrets subsection of the kubecli.yaml file and the
+	// checksum of the loaded secret versions, empty when the subsection isn't defined.
+	EnvSecret       string
+	SecretsChecksum string
+}
+
+// Document is a single YAML document rendered from a manifest file.
+type Document struct {
+	File string
+	YAML []byte
+}
+
+// TemplateError is returned when a manifest file can't be rendered.
+type TemplateError struct {
+	File string
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("can't render %v: %v", e.File, e.Err)
+}
+
+// Render executes the YAML files in a directory and its subdirectories as
+// templates and splits them into documents. Files are rendered in lexical
+// order and empty documents are left out.
+func Render(dir string, data Data) ([]Document, error) {
+	var docs []Document
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if f.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+		out, err := renderFile(path, data)
+		if err != nil {
+			return &TemplateError{File: path, Err: err}
+		}
+		docs = append(docs, Split(path, out)...)
+		return nil
+	})
+	return docs, err
+}
+
+// Execute a single manifest template.
+func renderFile(path string, data Data) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"env": os.Getenv,
+		}).
+		Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Split splits YAML of a file into documents, leaving out empty documents.
+func Split(file string, out []byte) []Document {
+	var docs []Document
+	for _, d := range separator.Split(string(out), -1) {
+		if len(strings.TrimSpace(stripComments(d))) == 0 {
+			continue
+		}
+		docs = append(docs, Document{File: file, YAML: []byte(d)})
+	}
+	return docs
+}
+
+// Remove comment lines so documents with only comments are recognized as empty.
+func stripComments(doc string) string {
+	var lines []string
+	for _, l := range strings.Split(doc, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(l), "#") {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Header is the kind and name of the object defined by a document.
+type Header struct {
+	Kind     string
+	Metadata struct {
+		Name      string
+		Namespace string
+	}
+}
+
+// Header parses the kind and name of the object defined by the document.
+func (d Document) Header() (Header, error) {
+	var h Header
+	err := yaml.Unmarshal(d.YAML, &h)
+	return h, err
+}
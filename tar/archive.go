@@ -3,59 +3,226 @@ package tar
 import (
 	"archive/tar"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/pgzip"
 )
 
+// Size of the blocks compressed in parallel by the gzip writer.
+const gzipBlockSize = 1 << 20
+
+// Modification time stored for every archived file.
+var epoch = time.Unix(0, 0)
+
+// SymlinkPolicy decides how symlinks pointing outside of the base directory are archived.
+type SymlinkPolicy int
+
+const (
+	// KeepSymlinks archives symlinks as they are, like docker build does.
+	KeepSymlinks SymlinkPolicy = iota
+	// CopySymlinks archives the files and directories symlinks point to in place of the symlinks.
+	CopySymlinks
+	// RejectSymlinks fails archiving with a SymlinkError.
+	RejectSymlinks
+)
+
+// UnsupportedFileError is returned when a file can't be archived, like sockets,
+// devices and named pipes.
+type UnsupportedFileError struct {
+	Path string
+	Mode os.FileMode
+}
+
+func (e *UnsupportedFileError) Error() string {
+	kind := "special file"
+	switch {
+	case e.Mode&os.ModeSocket != 0:
+		kind = "socket"
+	case e.Mode&os.ModeDevice != 0:
+		kind = "device"
+	case e.Mode&os.ModeNamedPipe != 0:
+		kind = "named pipe"
+	}
+	return fmt.Sprintf("can't archive %v, it's a %v", e.Path, kind)
+}
+
+// SymlinkError is returned when a symlink points outside of the base directory
+// and symlinks are archived with the RejectSymlinks policy.
+type SymlinkError struct {
+	Path   string
+	Target string
+}
+
+func (e *SymlinkError) Error() string {
+	return fmt.Sprintf("can't archive %v, symlink points outside of the archive to %v", e.Path, e.Target)
+}
+
 // Archive compresses a folder to .tar.gz archive.
-func Archive(files []string, arch string, base *string) error {
+func Archive(files []string, arch string, base *string, symlinks SymlinkPolicy) error {
 	f, err := os.Create(arch)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	gw := gzip.NewWriter(f)
-	defer gw.Close()
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
-	for i := range files {
-		if err := addFile(tw, files[i], base); err != nil {
-			return err
-		}
+	if err := WriteArchive(files, f, base, symlinks); err != nil {
+		f.Close()
+		return err
 	}
-	return nil
+	return f.Close()
 }
 
-// Read file contents and add it to the archive.
-func addFile(tw *tar.Writer, path string, base *string) error {
-	file, err := os.Open(path)
+// WriteArchive compresses files into a .tar.gz stream written to w.
+// The stream is compressed in parallel blocks using all available CPUs.
+func WriteArchive(files []string, w io.Writer, base *string, symlinks SymlinkPolicy) error {
+	gw, err := pgzip.NewWriterLevel(w, gzip.DefaultCompression)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	if stat, err := file.Stat(); err == nil {
-		// Create archive header for file
-		header := new(tar.Header)
-		header.Name = path
+	// Closing the writer stops its compression goroutines
+	if err := gw.SetConcurrency(gzipBlockSize, runtime.NumCPU()); err != nil {
+		gw.Close()
+		return err
+	}
+	if err := Write(files, gw, base, symlinks); err != nil {
+		gw.Close()
+		return err
+	}
+	// Flush the gzip trailer, without it the archive is truncated
+	return gw.Close()
+}
+
+// Write packs files and directories into an uncompressed tar stream written
+// to w. The stream is deterministic, the same files with the same contents
+// always produce the same bytes regardless of file order, modification times
+// and ownership.
+func Write(files []string, w io.Writer, base *string, symlinks SymlinkPolicy) error {
+	sorted := make([]string, len(files))
+	copy(sorted, files)
+	sort.Strings(sorted)
+	tw := tar.NewWriter(w)
+	for i := range sorted {
+		name := sorted[i]
 		if base != nil {
-			rel, err := filepath.Rel(*base, path)
+			rel, err := filepath.Rel(*base, sorted[i])
 			if err != nil {
 				return err
 			}
-			header.Name = rel
+			name = rel
 		}
-		header.Size = stat.Size()
-		header.Mode = int64(stat.Mode())
-		header.ModTime = stat.ModTime()
-		// Write the header to the archive
-		if err := tw.WriteHeader(header); err != nil {
+		if err := addFile(tw, sorted[i], name, base, symlinks); err != nil {
 			return err
 		}
-		// Copy file contents to the archive
-		if _, err := io.Copy(tw, file); err != nil {
+	}
+	// Flush the tar footer, without it the archive is truncated
+	return tw.Close()
+}
+
+// Add a file, directory or symlink to the archive under the given name.
+func addFile(tw *tar.Writer, path, name string, base *string, symlinks SymlinkPolicy) error {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	mode := stat.Mode()
+	if mode&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
 			return err
 		}
+		if base == nil || symlinks == KeepSymlinks || !escapes(path, *base) {
+			return writeHeader(tw, stat, name, target)
+		}
+		if symlinks == RejectSymlinks {
+			return &SymlinkError{Path: path, Target: target}
+		}
+		return addTarget(tw, path, name)
+	}
+	if !mode.IsRegular() && !mode.IsDir() {
+		return &UnsupportedFileError{Path: path, Mode: mode}
+	}
+	if err := writeHeader(tw, stat, name, ""); err != nil {
+		return err
+	}
+	if mode.IsDir() {
+		return nil
+	}
+	// Copy file contents to the archive
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// Add the contents of the file or directory a symlink points to under the symlink name.
+func addTarget(tw *tar.Writer, path, name string) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(target, func(p string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(target, p)
+		if err != nil {
+			return err
+		}
+		// Symlinks inside of the copied directory are kept as they are
+		return addFile(tw, p, filepath.Join(name, rel), nil, KeepSymlinks)
+	})
+}
+
+// Write a normalized archive header for a file, directory or symlink.
+func writeHeader(tw *tar.Writer, stat os.FileInfo, name, link string) error {
+	header, err := tar.FileInfoHeader(stat, link)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	if stat.IsDir() {
+		header.Name += "/"
+	}
+	// Normalize metadata which doesn't affect the build so archives are reproducible,
+	// files are owned by root like in build contexts sent by docker build
+	header.ModTime = epoch
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+	return tw.WriteHeader(header)
+}
+
+// Check if a symlink resolves to a path outside of the base directory.
+func escapes(path, base string) bool {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// Broken symlinks are resolved lexically
+		link, err := os.Readlink(path)
+		if err != nil {
+			return true
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(path), link)
+		}
+		target = link
+	}
+	if resolved, err := filepath.EvalSymlinks(base); err == nil {
+		base = resolved
+	}
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return true
 	}
-	return nil
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
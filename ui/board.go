@@ -0,0 +1,108 @@
+package ui
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+)
+
+// Task states shown on a status board.
+const (
+	taskRunning = iota
+	taskSucceeded
+	taskFailed
+)
+
+// StatusBoard renders a live status line for each of several concurrent tasks on StdOut.
+type StatusBoard struct {
+	names  []string
+	status []string
+	state  []int
+	frame  int
+	drawn  bool
+	mu     sync.Mutex
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// ShowStatusBoard creates and starts a status board with a line for each named task.
+func ShowStatusBoard(names []string) *StatusBoard {
+	board := &StatusBoard{
+		names:  names,
+		status: make([]string, len(names)),
+		state:  make([]int, len(names)),
+		done:   make(chan struct{}),
+	}
+	board.wg.Add(1)
+	go func() {
+		defer board.wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-board.done:
+				return
+			case <-ticker.C:
+				board.mu.Lock()
+				board.frame++
+				board.render()
+				board.mu.Unlock()
+			}
+		}
+	}()
+	return board
+}
+
+// Update changes the status line of a running task.
+func (board *StatusBoard) Update(task int, status string) {
+	board.mu.Lock()
+	defer board.mu.Unlock()
+	board.status[task] = status
+}
+
+// Success marks a task as succeeded with a final status line.
+func (board *StatusBoard) Success(task int, status string) {
+	board.mu.Lock()
+	defer board.mu.Unlock()
+	board.status[task] = status
+	board.state[task] = taskSucceeded
+}
+
+// Fail marks a task as failed with a final status line.
+func (board *StatusBoard) Fail(task int, status string) {
+	board.mu.Lock()
+	defer board.mu.Unlock()
+	board.status[task] = status
+	board.state[task] = taskFailed
+}
+
+// Stop stops refreshing the status board and leaves the last state on StdOut.
+func (board *StatusBoard) Stop() {
+	close(board.done)
+	board.wg.Wait()
+	board.mu.Lock()
+	defer board.mu.Unlock()
+	board.render()
+}
+
+// Redraw all status lines in place, the caller must hold the lock.
+func (board *StatusBoard) render() {
+	chars := spinner.CharSets[14]
+	if board.drawn {
+		// Move the cursor back to the first line of the board
+		fmt.Printf("\033[%dA", len(board.names))
+	}
+	board.drawn = true
+	for i, name := range board.names {
+		icon := chars[board.frame%len(chars)]
+		switch board.state[i] {
+		case taskSucceeded:
+			icon = green("✓")
+		case taskFailed:
+			icon = red("✖")
+		}
+		fmt.Printf("\r\033[K%v %v%v %v\n", icon, bold(name), bold(":"), board.status[i])
+	}
+}
@@ -0,0 +1,29 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+var cyan = color.New(color.FgCyan).SprintFunc()
+
+// Diff prints out a unified diff to StdOut, added lines are green and
+// removed lines are red.
+func Diff(diff string) {
+	for _, l := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+			fmt.Println(bold(l))
+		case strings.HasPrefix(l, "+"):
+			fmt.Println(green(l))
+		case strings.HasPrefix(l, "-"):
+			fmt.Println(red(l))
+		case strings.HasPrefix(l, "@@"):
+			fmt.Println(cyan(l))
+		default:
+			fmt.Println(l)
+		}
+	}
+}
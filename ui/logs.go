@@ -0,0 +1,27 @@
+package ui
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/fatih/color"
+)
+
+// Colors of log line prefixes, picked by the source of the line.
+var logColors = []*color.Color{
+	color.New(color.FgCyan),
+	color.New(color.FgGreen),
+	color.New(color.FgYellow),
+	color.New(color.FgBlue),
+	color.New(color.FgMagenta),
+	color.New(color.FgRed),
+}
+
+// LogLine prints out a log line to StdOut prefixed with its source, lines of
+// the same source always have the same color.
+func LogLine(source, line string) {
+	h := fnv.New32a()
+	h.Write([]byte(source))
+	c := logColors[h.Sum32()%uint32(len(logColors))]
+	fmt.Println(fmt.Sprintf("%v %v", c.Sprintf("[%v]", source), line))
+}
@@ -27,3 +27,8 @@ func WarnMessage(msg string) {
 func Message(msg string) {
 	fmt.Println(fmt.Sprintf("%v", msg))
 }
+
+// ClearScreen clears the terminal and moves the cursor to the top.
+func ClearScreen() {
+	fmt.Print("\033[H\033[2J")
+}
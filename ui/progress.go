@@ -0,0 +1,67 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// Width of the progress bar in characters.
+const progressWidth = 30
+
+// ProgressBar renders byte-level progress of a step on StdOut.
+type ProgressBar struct {
+	step     int8
+	descr    string
+	mu       sync.Mutex
+	rendered time.Time
+}
+
+// ShowProgress creates and renders an empty task progress bar on StdOut.
+func ShowProgress(step int8, descr string) *ProgressBar {
+	bar := &ProgressBar{
+		step:  step,
+		descr: descr,
+	}
+	bar.Update(0, -1)
+	return bar
+}
+
+// Update redraws the progress bar with the number of bytes done out of total.
+// A negative total means the size is unknown and only the bytes done are shown.
+func (bar *ProgressBar) Update(done, total int64) {
+	bar.mu.Lock()
+	defer bar.mu.Unlock()
+	// Limit redraws so fast transfers don't flood the terminal
+	if time.Since(bar.rendered) < 100*time.Millisecond && (total < 0 || done < total) {
+		return
+	}
+	bar.rendered = time.Now()
+	status := humanize.Bytes(uint64(done))
+	if total > 0 {
+		filled := int(done * progressWidth / total)
+		if filled > progressWidth {
+			filled = progressWidth
+		}
+		graph := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+		status = fmt.Sprintf("[%v] %3d%% %v / %v", graph, done*100/total, humanize.Bytes(uint64(done)), humanize.Bytes(uint64(total)))
+	}
+	fmt.Printf("\r\033[K%v %v%v %v %v", bold("Step"), bold(bar.step), bold(":"), bar.descr, status)
+}
+
+// ProgressFail clears the progress bar and prints out a failing message.
+func ProgressFail(step int8, descr string, bar *ProgressBar) {
+	bar.mu.Lock()
+	defer bar.mu.Unlock()
+	fmt.Println(fmt.Sprintf("\r\033[K%v %v %v%v %v", red("✖"), bold("Step"), bold(step), bold(":"), descr))
+}
+
+// ProgressSuccess clears the progress bar and prints out a success message.
+func ProgressSuccess(step int8, descr string, bar *ProgressBar) {
+	bar.mu.Lock()
+	defer bar.mu.Unlock()
+	fmt.Println(fmt.Sprintf("\r\033[K%v %v %v%v %v", green("✓"), bold("Step"), bold(step), bold(":"), descr))
+}
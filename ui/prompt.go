@@ -36,3 +36,14 @@ func Choose(description, help, def string, items []string) (string, error) {
 	err := survey.AskOne(p, &res, nil)
 	return res, err
 }
+
+// AskSecret displays a prompt on the terminal for a value which isn't echoed back.
+func AskSecret(question, help string) (string, error) {
+	p := &survey.Password{
+		Message: question,
+		Help:    help,
+	}
+	res := ""
+	err := survey.AskOne(p, &res, survey.Required)
+	return res, err
+}
@@ -59,8 +59,9 @@ func GetBuild(project, id string) (BuildResult, error) {
 	return res, nil
 }
 
-// CreateBuild creates and starts a CloudBuild on GCP.
-func CreateBuild(project, name, bucket, object string, tags []string) (BuildResult, error) {
+// CreateBuild creates and starts a CloudBuild on GCP. The Dockerfile path is
+// relative to the root of the source archive.
+func CreateBuild(project, name, bucket, object, dockerfile string, tags []string) (BuildResult, error) {
 	res := BuildResult{
 		Status: UnknownBuildStatus,
 	}
@@ -83,7 +84,7 @@ func CreateBuild(project, name, bucket, object string, tags []string) (BuildResu
 		Steps: []*cloudbuild.BuildStep{
 			&cloudbuild.BuildStep{
 				Name: "gcr.io/cloud-builders/docker",
-				Args: generateArgs(images),
+				Args: generateArgs(images, dockerfile),
 			},
 		},
 	}
@@ -139,11 +140,11 @@ func generateImageNames(project, name string, tags []string) []string {
 }
 
 // Generates CloudBuild arguments for building docker images.
-func generateArgs(images []string) []string {
+func generateArgs(images []string, dockerfile string) []string {
 	var args []string
 	args = append(args, "build")
 	args = append(args, "-f")
-	args = append(args, "Dockerfile")
+	args = append(args, dockerfile)
 	for _, img := range images {
 		args = append(args, "-t")
 		args = append(args, img)
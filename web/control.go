@@ -0,0 +1,132 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+// Pod template annotation changed by kubectl rollout restart.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// UnsupportedError is returned when an operation isn't supported by a workload kind.
+type UnsupportedError struct {
+	// Operation in past tense, like scaled.
+	Operation string
+	Kind      string
+	Name      string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%v %v can't be %v", e.Kind, e.Name, e.Operation)
+}
+
+// PausedError is returned when a paused Deployment is changed in a way which
+// needs a rollout or its rollout is awaited, the rollout wouldn't start until
+// it's resumed.
+type PausedError struct {
+	Namespace string
+	Name      string
+}
+
+func (e *PausedError) Error() string {
+	return fmt.Sprintf("deployment %v in %v namespace is paused", e.Name, e.Namespace)
+}
+
+// ScaleWorkload sets the number of replicas of a Deployment or a StatefulSet.
+func ScaleWorkload(w Workload, replicas int32, info ClusterInfo) error {
+	client, err := newClient(info)
+	if err != nil {
+		return err
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, _, err := getWorkload(client, w)
+		if err != nil {
+			return err
+		}
+		switch res := obj.(type) {
+		case *appsv1.Deployment:
+			res.Spec.Replicas = &replicas
+		case *appsv1.StatefulSet:
+			res.Spec.Replicas = &replicas
+		default:
+			return &UnsupportedError{Operation: "scaled", Kind: w.Kind, Name: w.Name}
+		}
+		return putWorkload(client, obj)
+	})
+	return workloadError(err, w)
+}
+
+// RestartWorkload replaces all pods of a Deployment, StatefulSet or DaemonSet
+// with a rollout, the same way kubectl rollout restart does.
+func RestartWorkload(w Workload, info ClusterInfo) error {
+	client, err := newClient(info)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{
+						restartedAtAnnotation: time.Now().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	switch w.Kind {
+	case DeploymentKind, "":
+		// Like kubectl, paused Deployments aren't restarted
+		dpl, err := client.AppsV1().Deployments(w.Namespace).Get(w.Name, metav1.GetOptions{})
+		if err != nil {
+			return workloadError(err, w)
+		}
+		if dpl.Spec.Paused {
+			return &PausedError{Namespace: w.Namespace, Name: w.Name}
+		}
+		_, err = client.AppsV1().Deployments(w.Namespace).Patch(w.Name, types.StrategicMergePatchType, patch)
+		return workloadError(err, w)
+	case StatefulSetKind:
+		_, err = client.AppsV1().StatefulSets(w.Namespace).Patch(w.Name, types.StrategicMergePatchType, patch)
+	case DaemonSetKind:
+		_, err = client.AppsV1().DaemonSets(w.Namespace).Patch(w.Name, types.StrategicMergePatchType, patch)
+	default:
+		return &UnsupportedError{Operation: "restarted", Kind: w.Kind, Name: w.Name}
+	}
+	return workloadError(err, w)
+}
+
+// PauseWorkload pauses or resumes rollouts of a Deployment. Changes to a
+// paused Deployment aren't rolled out until it's resumed.
+func PauseWorkload(w Workload, paused bool, info ClusterInfo) error {
+	if w.Kind != DeploymentKind && len(w.Kind) > 0 {
+		operation := "paused"
+		if !paused {
+			operation = "resumed"
+		}
+		return &UnsupportedError{Operation: operation, Kind: w.Kind, Name: w.Name}
+	}
+	client, err := newClient(info)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"paused": paused,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.AppsV1().Deployments(w.Namespace).Patch(w.Name, types.StrategicMergePatchType, patch)
+	return workloadError(err, w)
+}
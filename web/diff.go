@@ -0,0 +1,204 @@
+package web
+
+import (
+	"github.com/ajdnik/kube-cli/manifest"
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// Metadata fields set by the cluster which don't describe the desired state.
+var generatedFields = []string{
+	"managedFields",
+	"resourceVersion",
+	"generation",
+	"uid",
+	"creationTimestamp",
+	"selfLink",
+}
+
+// Annotations set by the cluster or kubectl which don't describe the desired state.
+var generatedAnnotations = []string{
+	"deployment.kubernetes.io/revision",
+	"kubectl.kubernetes.io/last-applied-configuration",
+}
+
+// ObjectDiff is the live and the desired state of an object as YAML, live is
+// empty when the object doesn't exist in the cluster yet.
+type ObjectDiff struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Live      []byte
+	Desired   []byte
+}
+
+// DiffManifests compares objects defined in YAML manifests with the cluster.
+// The desired state is the result of a server-side apply dry-run, so it
+// includes defaults and fields owned by other managers.
+func DiffManifests(manifests []manifest.Document, namespace string, info ClusterInfo) ([]ObjectDiff, error) {
+	var diffs []ObjectDiff
+	objs, err := parseManifests(manifests)
+	if err != nil {
+		return diffs, err
+	}
+	dyn, mapper, err := newDynamicClient(info)
+	if err != nil {
+		return diffs, err
+	}
+	force := true
+	for i, obj := range objs {
+		merr := &ManifestError{File: manifests[i].File, Kind: obj.GetKind(), Name: obj.GetName()}
+		res, err := objectResource(dyn, mapper, obj, namespace)
+		if err != nil {
+			merr.Err = err
+			return diffs, merr
+		}
+		live, err := res.Get(obj.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			live = nil
+		} else if err != nil {
+			merr.Err = err
+			return diffs, merr
+		}
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			merr.Err = err
+			return diffs, merr
+		}
+		opts := metav1.PatchOptions{
+			FieldManager: FieldManager,
+			Force:        &force,
+			DryRun:       []string{metav1.DryRunAll},
+		}
+		desired, err := res.Patch(obj.GetName(), types.ApplyPatchType, data, opts)
+		// Changed jobs are created again on apply, so the manifest is their desired state
+		gvk := obj.GroupVersionKind()
+		if apierrors.IsInvalid(err) && gvk.Group == "batch" && gvk.Kind == JobKind {
+			desired, err = obj, nil
+		}
+		if err != nil {
+			merr.Err = err
+			return diffs, merr
+		}
+		diff, err := objectDiff(obj.GetKind(), obj.GetNamespace(), obj.GetName(), live, desired)
+		if err != nil {
+			merr.Err = err
+			return diffs, merr
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// DiffWorkloads compares workloads in the cluster with the state they would
+// have after their containers are updated to the docker image. The desired
+// state is the result of a server-side update dry-run.
+func DiffWorkloads(workloads []Workload, docker string, info ClusterInfo) ([]ObjectDiff, error) {
+	var diffs []ObjectDiff
+	client, err := newClient(info)
+	if err != nil {
+		return diffs, err
+	}
+	dyn, err := dynamic.NewForConfig(restConfig(info))
+	if err != nil {
+		return diffs, err
+	}
+	for _, w := range workloads {
+		obj, spec, err := getWorkload(client, w)
+		if err != nil {
+			return diffs, workloadError(err, w)
+		}
+		gvr, gvk := workloadResource(w.Kind)
+		live, err := toUnstructured(obj, gvk)
+		if err != nil {
+			return diffs, err
+		}
+		if _, err := setImages(spec, w, docker); err != nil {
+			return diffs, err
+		}
+		setEnvFrom(obj, spec, w)
+		desired, err := toUnstructured(obj, gvk)
+		if err != nil {
+			return diffs, err
+		}
+		// Job pod templates are immutable and can't be updated, not even in a dry-run
+		if w.Kind != JobKind {
+			desired, err = dyn.Resource(gvr).Namespace(w.Namespace).Update(desired, metav1.UpdateOptions{
+				DryRun: []string{metav1.DryRunAll},
+			})
+			if err != nil {
+				return diffs, workloadError(err, w)
+			}
+		}
+		diff, err := objectDiff(gvk.Kind, w.Namespace, w.Name, live, desired)
+		if err != nil {
+			return diffs, err
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// Resource and kind of a workload kind, the API versions match getWorkload.
+func workloadResource(kind string) (schema.GroupVersionResource, schema.GroupVersionKind) {
+	switch kind {
+	case StatefulSetKind:
+		return schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind}
+	case DaemonSetKind:
+		return schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind}
+	case CronJobKind:
+		return schema.GroupVersionResource{Group: "batch", Version: "v1beta1", Resource: "cronjobs"}, schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: kind}
+	case JobKind:
+		return schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}, schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: kind}
+	}
+	return schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: DeploymentKind}
+}
+
+// Convert a typed object into an unstructured one, typed clients don't set the kind.
+func toUnstructured(obj interface{}, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	res := &unstructured.Unstructured{Object: data}
+	res.SetGroupVersionKind(gvk)
+	return res, nil
+}
+
+// Build a diff of an object from its live and desired state.
+func objectDiff(kind, namespace, name string, live, desired *unstructured.Unstructured) (ObjectDiff, error) {
+	diff := ObjectDiff{Kind: kind, Namespace: namespace, Name: name}
+	var err error
+	if live != nil {
+		if diff.Live, err = normalizedYAML(live); err != nil {
+			return diff, err
+		}
+	}
+	diff.Desired, err = normalizedYAML(desired)
+	return diff, err
+}
+
+// Marshal an object into YAML without the status and fields generated by the cluster.
+func normalizedYAML(obj *unstructured.Unstructured) ([]byte, error) {
+	res := obj.DeepCopy()
+	unstructured.RemoveNestedField(res.Object, "status")
+	for _, f := range generatedFields {
+		unstructured.RemoveNestedField(res.Object, "metadata", f)
+	}
+	annotations := res.GetAnnotations()
+	for _, a := range generatedAnnotations {
+		delete(annotations, a)
+	}
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(res.Object, "metadata", "annotations")
+	} else {
+		res.SetAnnotations(annotations)
+	}
+	return yaml.Marshal(res.Object)
+}
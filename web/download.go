@@ -1,38 +1,211 @@
 package web
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Number of attempts made to download a file before giving up.
+const downloadAttempts = 5
+
+// How long a download can go without receiving data before it's retried.
+const downloadIdleTimeout = 30 * time.Second
+
+// Returned when no data was received for longer than downloadIdleTimeout.
+var errDownloadStalled = errors.New("download stalled, no data received")
+
+// ProgressFunc is called while transferring data with the number of bytes
+// transferred so far and the total number of bytes, which is -1 when unknown.
+type ProgressFunc func(done, total int64)
+
+// StatusError is returned when a server responds with an unexpected HTTP status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response %v %v from %v", e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+}
+
 // DownloadFile downloads a file from a given url and saves it in the
-// local filesystem.
-func DownloadFile(file, url string) (int64, error) {
-	// Create the file, but give it a tmp file extension, this means we won't overwrite a
+// local filesystem. Failed transfers are retried with an exponential backoff
+// and resumed from where they stopped when the server supports range requests.
+func DownloadFile(file, url string, progress ProgressFunc) (int64, error) {
+	// Download into a file with a tmp file extension, this means we won't overwrite a
 	// file until it's downloaded, but we'll remove the tmp extension once downloaded.
-	out, err := os.Create(file + ".tmp")
+	tmp := file + ".tmp"
+	client := &http.Client{
+		Transport: newTransport(),
+	}
+	var size int64
+	err := withRetry(downloadAttempts, retryableDownload, func() error {
+		var err error
+		size, err = downloadPart(client, tmp, url, progress)
+		return err
+	})
 	if err != nil {
+		os.Remove(tmp)
 		return -1, err
 	}
-	defer out.Close()
+	err = os.Rename(tmp, file)
+	if err != nil {
+		return -1, err
+	}
+	return size, nil
+}
+
+// Create an HTTP transport with connection timeouts which honors the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout: 10 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+}
 
-	// Get the data
-	resp, err := http.Get(url)
+// Download the remainder of a file, appending to the partially downloaded
+// tmp file when the server supports range requests.
+func downloadPart(client *http.Client, tmp, url string, progress ProgressFunc) (int64, error) {
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return -1, err
+	}
+	defer out.Close()
+	stat, err := out.Stat()
+	if err != nil {
+		return -1, err
+	}
+	offset := stat.Size()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return -1, err
+	}
+	// Canceling the request aborts a body read which stalled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req = req.WithContext(ctx)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return -1, err
 	}
 	defer resp.Body.Close()
-
-	_, err = io.Copy(out, resp.Body)
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The server ignored the range request, start from the beginning
+		offset = 0
+		if resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+	case http.StatusPartialContent:
+		total = parseContentRangeTotal(resp.Header.Get("Content-Range"))
+		if total < 0 && resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is invalid, discard it and let the next attempt start over
+		if err := out.Truncate(0); err != nil {
+			return -1, err
+		}
+		return -1, &StatusError{URL: url, StatusCode: resp.StatusCode}
+	default:
+		return -1, &StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+	if err := out.Truncate(offset); err != nil {
+		return -1, err
+	}
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		return -1, err
+	}
+	var w io.Writer = out
+	if progress != nil {
+		progress(offset, total)
+		w = &progressWriter{w: out, done: offset, total: total, progress: progress}
+	}
+	body := &idleReader{r: resp.Body, timeout: downloadIdleTimeout, timer: time.AfterFunc(downloadIdleTimeout, cancel)}
+	defer body.timer.Stop()
+	n, err := io.Copy(w, body)
 	if err != nil {
 		return -1, err
 	}
+	size := offset + n
+	if total >= 0 && size != total {
+		return -1, io.ErrUnexpectedEOF
+	}
+	return size, nil
+}
 
-	err = os.Rename(file+".tmp", file)
+// Extract the complete length from a Content-Range header,
+// for example 'bytes 100-199/200', or return -1 if unknown.
+func parseContentRangeTotal(header string) int64 {
+	i := strings.LastIndex(header, "/")
+	if i < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(header[i+1:], 10, 64)
 	if err != nil {
-		return -1, err
+		return -1
 	}
+	return total
+}
+
+// Decide whether a failed download attempt should be retried.
+func retryableDownload(err error) bool {
+	if serr, ok := err.(*StatusError); ok {
+		return serr.StatusCode >= 500 || serr.StatusCode == http.StatusTooManyRequests || serr.StatusCode == http.StatusRequestedRangeNotSatisfiable
+	}
+	// Local filesystem errors won't go away by retrying
+	if _, ok := err.(*os.PathError); ok {
+		return false
+	}
+	return true
+}
+
+// idleReader cancels a request when reading its body makes no progress for
+// longer than the timeout, the timer is reset after each read.
+type idleReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if !ir.timer.Stop() {
+		// The timer fired and canceled the request
+		return n, errDownloadStalled
+	}
+	ir.timer.Reset(ir.timeout)
+	return n, err
+}
+
+// progressWriter reports the number of bytes written through it.
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
 
-	return resp.ContentLength, nil
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.done += int64(n)
+	pw.progress(pw.done, pw.total)
+	return n, err
 }
@@ -0,0 +1,282 @@
+package web
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// EnvChecksumAnnotation is the pod template annotation with the checksum of
+// the environment ConfigMap, changing it rolls out pods with the new values.
+const EnvChecksumAnnotation = "kube-cli/env-checksum"
+
+// SecretsChecksumAnnotation is the pod template annotation with the checksum
+// of the Secret Manager versions loaded into the environment Secret.
+const SecretsChecksumAnnotation = "kube-cli/secrets-checksum"
+
+// EnvVar is an environment variable of a container, From describes where the
+// value comes from when it isn't set directly.
+type EnvVar struct {
+	Name  string
+	Value string
+	From  string
+}
+
+// SyncConfigMap creates a ConfigMap with data or updates it when its data
+// is different and reports if it was changed.
+func SyncConfigMap(name, namespace string, data map[string]string, info ClusterInfo) (bool, error) {
+	client, err := newClient(info)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = client.CoreV1().ConfigMaps(namespace).Create(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+					Labels:    map[string]string{"app.kubernetes.io/managed-by": FieldManager},
+				},
+				Data: data,
+			})
+			changed = err == nil
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(cm.Data, data) {
+			return nil
+		}
+		cm.Data = data
+		_, err = client.CoreV1().ConfigMaps(namespace).Update(cm)
+		changed = err == nil
+		return err
+	})
+	return changed, err
+}
+
+// ContainerEnv returns the environment variables of a workload container and
+// the ConfigMaps and Secrets it loads variables from. The first container is
+// used when container is empty.
+func ContainerEnv(w Workload, container string, info ClusterInfo) ([]EnvVar, []string, error) {
+	client, err := newClient(info)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, spec, err := getWorkload(client, w)
+	if err != nil {
+		return nil, nil, workloadError(err, w)
+	}
+	c, err := findContainer(spec, w, container)
+	if err != nil {
+		return nil, nil, err
+	}
+	var vars []EnvVar
+	for _, e := range c.Env {
+		vars = append(vars, EnvVar{Name: e.Name, Value: e.Value, From: envSource(e.ValueFrom)})
+	}
+	var sources []string
+	for _, e := range c.EnvFrom {
+		if e.ConfigMapRef != nil {
+			sources = append(sources, fmt.Sprintf("ConfigMap %v", e.ConfigMapRef.Name))
+		}
+		if e.SecretRef != nil {
+			sources = append(sources, fmt.Sprintf("Secret %v", e.SecretRef.Name))
+		}
+	}
+	return vars, sources, nil
+}
+
+// SetContainerEnv sets and removes environment variables of a workload
+// container, which rolls out the workload. The first container is used when
+// container is empty. Jobs can't be changed, since their pods can only be
+// changed by running them again.
+func SetContainerEnv(w Workload, container string, set map[string]string, unset []string, info ClusterInfo) error {
+	client, err := newClient(info)
+	if err != nil {
+		return err
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, spec, err := getWorkload(client, w)
+		if err != nil {
+			return err
+		}
+		if _, ok := obj.(*batchv1.Job); ok {
+			return &UnsupportedError{Operation: "changed", Kind: w.Kind, Name: w.Name}
+		}
+		if dpl, ok := obj.(*appsv1.Deployment); ok && dpl.Spec.Paused {
+			return &PausedError{Namespace: w.Namespace, Name: w.Name}
+		}
+		c, err := findContainer(spec, w, container)
+		if err != nil {
+			return err
+		}
+		// Updating an unchanged workload would roll it out for nothing
+		if !envChanged(c.Env, set, unset) {
+			return nil
+		}
+		var env []corev1.EnvVar
+		for _, e := range c.Env {
+			if _, ok := set[e.Name]; ok || containsString(unset, e.Name) {
+				continue
+			}
+			env = append(env, e)
+		}
+		// Keep the order of existing variables, replaced ones are moved to the end
+		for _, name := range sortedKeys(set) {
+			env = append(env, corev1.EnvVar{Name: name, Value: set[name]})
+		}
+		c.Env = env
+		return putWorkload(client, obj)
+	})
+	return workloadError(err, w)
+}
+
+// Check if setting and removing variables changes the environment of a container.
+func envChanged(env []corev1.EnvVar, set map[string]string, unset []string) bool {
+	current := make(map[string]string)
+	for _, e := range env {
+		// Variables loaded from other sources are replaced by the set value
+		if e.ValueFrom == nil {
+			current[e.Name] = e.Value
+		}
+	}
+	for name, value := range set {
+		if v, ok := current[name]; !ok || v != value {
+			return true
+		}
+	}
+	for _, e := range env {
+		if containsString(unset, e.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find a container of a pod spec by name, the first container when name is empty.
+func findContainer(spec *corev1.PodSpec, w Workload, name string) (*corev1.Container, error) {
+	if len(name) == 0 && len(spec.Containers) > 0 {
+		return &spec.Containers[0], nil
+	}
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == name {
+			return &spec.Containers[i], nil
+		}
+	}
+	return nil, &ContainerNotFoundError{Kind: w.Kind, Workload: w.Name, Container: name}
+}
+
+// Describe where the value of an environment variable comes from.
+func envSource(src *corev1.EnvVarSource) string {
+	switch {
+	case src == nil:
+		return ""
+	case src.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("ConfigMap %v key %v", src.ConfigMapKeyRef.Name, src.ConfigMapKeyRef.Key)
+	case src.SecretKeyRef != nil:
+		return fmt.Sprintf("Secret %v key %v", src.SecretKeyRef.Name, src.SecretKeyRef.Key)
+	case src.FieldRef != nil:
+		return fmt.Sprintf("field %v", src.FieldRef.FieldPath)
+	case src.ResourceFieldRef != nil:
+		return fmt.Sprintf("resource %v", src.ResourceFieldRef.Resource)
+	}
+	return ""
+}
+
+// Load the environment ConfigMap and Secret of a workload into its containers
+// and set their checksum annotations, so pods are rolled out when they change.
+func setEnvFrom(obj interface{}, spec *corev1.PodSpec, w Workload) {
+	if len(w.EnvConfigMap) == 0 && len(w.EnvSecret) == 0 {
+		return
+	}
+	for i, c := range spec.Containers {
+		if len(w.Containers) > 0 && !containsString(w.Containers, c.Name) {
+			continue
+		}
+		hasConfigMap, hasSecret := false, false
+		for _, e := range c.EnvFrom {
+			if e.ConfigMapRef != nil && e.ConfigMapRef.Name == w.EnvConfigMap {
+				hasConfigMap = true
+			}
+			if e.SecretRef != nil && e.SecretRef.Name == w.EnvSecret {
+				hasSecret = true
+			}
+		}
+		if len(w.EnvConfigMap) > 0 && !hasConfigMap {
+			spec.Containers[i].EnvFrom = append(spec.Containers[i].EnvFrom, corev1.EnvFromSource{
+				ConfigMapRef: &corev1.ConfigMapEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: w.EnvConfigMap},
+				},
+			})
+		}
+		if len(w.EnvSecret) > 0 && !hasSecret {
+			spec.Containers[i].EnvFrom = append(spec.Containers[i].EnvFrom, corev1.EnvFromSource{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: w.EnvSecret},
+				},
+			})
+		}
+	}
+	meta := templateMeta(obj)
+	if meta == nil {
+		return
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	if len(w.EnvConfigMap) > 0 {
+		meta.Annotations[EnvChecksumAnnotation] = w.EnvChecksum
+	}
+	if len(w.EnvSecret) > 0 {
+		meta.Annotations[SecretsChecksumAnnotation] = w.SecretsChecksum
+	}
+}
+
+// Metadata of the pod template of a workload retrieved by getWorkload.
+func templateMeta(obj interface{}) *metav1.ObjectMeta {
+	switch res := obj.(type) {
+	case *appsv1.Deployment:
+		return &res.Spec.Template.ObjectMeta
+	case *appsv1.StatefulSet:
+		return &res.Spec.Template.ObjectMeta
+	case *appsv1.DaemonSet:
+		return &res.Spec.Template.ObjectMeta
+	case *batchv1beta1.CronJob:
+		return &res.Spec.JobTemplate.Spec.Template.ObjectMeta
+	case *batchv1.Job:
+		return &res.Spec.Template.ObjectMeta
+	}
+	return nil
+}
+
+// Check if a string is in a slice.
+func containsString(items []string, s string) bool {
+	for _, i := range items {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys of a map in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
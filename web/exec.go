@@ -0,0 +1,160 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// NoReadyPodError is returned when a workload doesn't have a ready pod.
+type NoReadyPodError struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (e *NoReadyPodError) Error() string {
+	return fmt.Sprintf("%v %v in namespace %v doesn't have a ready pod", e.Kind, e.Name, e.Namespace)
+}
+
+// CommandExitError is returned when a command run in a container exits with
+// a non-zero code.
+type CommandExitError struct {
+	Code int
+}
+
+func (e *CommandExitError) Error() string {
+	return fmt.Sprintf("command terminated with exit code %v", e.Code)
+}
+
+// TerminalSize is the width and height of a terminal in characters.
+type TerminalSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// ExecStreams connects a command running in a container with the local
+// terminal. Stdin can be nil, with a TTY the output is only written to
+// Stdout and the TTY is resized to the sizes sent to Sizes.
+type ExecStreams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	TTY    bool
+	Sizes  <-chan TerminalSize
+}
+
+// ReadyPod returns the name of a ready pod of a workload.
+func ReadyPod(w Workload, info ClusterInfo) (string, error) {
+	client, err := newClient(info)
+	if err != nil {
+		return "", err
+	}
+	obj, _, err := getWorkload(client, w)
+	if err != nil {
+		return "", workloadError(err, w)
+	}
+	pods, err := workloadPods(client, obj)
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+				return pod.Name, nil
+			}
+		}
+	}
+	return "", &NoReadyPodError{Kind: w.Kind, Namespace: w.Namespace, Name: w.Name}
+}
+
+// ExecPod runs a command in a container of a pod and streams its input and
+// output until it exits. The default container of the pod is used when
+// container is empty.
+func ExecPod(namespace, pod, container string, command []string, streams ExecStreams, info ClusterInfo) error {
+	client, err := newClient(info)
+	if err != nil {
+		return err
+	}
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     streams.Stdin != nil,
+			Stdout:    streams.Stdout != nil,
+			Stderr:    streams.Stderr != nil && !streams.TTY,
+			TTY:       streams.TTY,
+		}, scheme.ParameterCodec)
+	exec, err := remotecommand.NewSPDYExecutor(restConfig(info), http.MethodPost, req.URL())
+	if err != nil {
+		return err
+	}
+	opts := remotecommand.StreamOptions{
+		Stdin:  streams.Stdin,
+		Stdout: streams.Stdout,
+		Tty:    streams.TTY,
+	}
+	if !streams.TTY {
+		opts.Stderr = streams.Stderr
+	}
+	if streams.Sizes != nil {
+		opts.TerminalSizeQueue = sizeQueue(streams.Sizes)
+	}
+	err = exec.Stream(opts)
+	if e, ok := err.(utilexec.ExitError); ok && e.Exited() {
+		return &CommandExitError{Code: e.ExitStatus()}
+	}
+	return err
+}
+
+// ForwardPorts forwards local ports to a pod until stop is closed. Ports are
+// given like kubectl port-forward does, either PORT or LOCAL:REMOTE. Ready is
+// closed once the ports are listened on and the forwarded ports are written
+// to out.
+func ForwardPorts(namespace, pod string, ports []string, stop <-chan struct{}, ready chan struct{}, out io.Writer, info ClusterInfo) error {
+	client, err := newClient(info)
+	if err != nil {
+		return err
+	}
+	cfg := restConfig(info)
+	transport, upgrader, err := spdy.RoundTripperFor(cfg)
+	if err != nil {
+		return err
+	}
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+	fw, err := portforward.New(dialer, ports, stop, ready, out, out)
+	if err != nil {
+		return err
+	}
+	return fw.ForwardPorts()
+}
+
+// sizeQueue passes terminal sizes to remote commands.
+type sizeQueue <-chan TerminalSize
+
+func (q sizeQueue) Next() *remotecommand.TerminalSize {
+	size, ok := <-q
+	if !ok {
+		return nil
+	}
+	return &remotecommand.TerminalSize{Width: size.Width, Height: size.Height}
+}
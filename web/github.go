@@ -23,6 +23,7 @@ type LatestRelease struct {
 func GetLatestRelease(shaFile, tarFile string) (LatestRelease, error) {
 	var release LatestRelease
 	var trans = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
 		Dial: (&net.Dialer{
 			Timeout: 5 * time.Second,
 		}).Dial,
@@ -0,0 +1,226 @@
+package web
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ajdnik/kube-cli/manifest"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Storage driver of Helm release information, the same as Helm uses by default.
+const helmDriver = "secret"
+
+// HelmRelease describes a Helm chart installed to the cluster.
+type HelmRelease struct {
+	Name      string
+	Namespace string
+	// Path of the chart directory or archive.
+	Chart string
+	// Values files merged in order, later files take precedence.
+	ValuesFiles []string
+	// Values which take precedence over values files, keys are dotted paths like image.tag.
+	Values map[string]string
+	// How long to wait for release resources to be ready, zero doesn't wait.
+	Wait time.Duration
+}
+
+// UpgradeRelease installs a Helm release or upgrades it when it's already
+// installed and returns the release revision.
+func UpgradeRelease(rel HelmRelease, info ClusterInfo) (int, error) {
+	cfg, err := helmConfig(rel.Namespace, info)
+	if err != nil {
+		return 0, err
+	}
+	chart, vals, err := loadChart(rel)
+	if err != nil {
+		return 0, err
+	}
+	// Install the release if it doesn't have any revisions, like helm upgrade --install
+	installed, err := releaseInstalled(cfg, rel.Name)
+	if err != nil {
+		return 0, err
+	}
+	if !installed {
+		install := action.NewInstall(cfg)
+		install.ReleaseName = rel.Name
+		install.Namespace = rel.Namespace
+		install.Wait = rel.Wait > 0
+		install.Timeout = rel.Wait
+		res, err := install.Run(chart, vals)
+		if err != nil {
+			return 0, err
+		}
+		return res.Version, nil
+	}
+	upgrade := action.NewUpgrade(cfg)
+	upgrade.Namespace = rel.Namespace
+	upgrade.Wait = rel.Wait > 0
+	upgrade.Timeout = rel.Wait
+	res, err := upgrade.Run(rel.Name, chart, vals)
+	if err != nil {
+		return 0, err
+	}
+	return res.Version, nil
+}
+
+// RenderRelease renders the manifests UpgradeRelease would install or
+// upgrade, without changing the release. Hooks aren't included.
+func RenderRelease(rel HelmRelease, info ClusterInfo) ([]manifest.Document, error) {
+	cfg, err := helmConfig(rel.Namespace, info)
+	if err != nil {
+		return nil, err
+	}
+	chart, vals, err := loadChart(rel)
+	if err != nil {
+		return nil, err
+	}
+	installed, err := releaseInstalled(cfg, rel.Name)
+	if err != nil {
+		return nil, err
+	}
+	var res *release.Release
+	if !installed {
+		install := action.NewInstall(cfg)
+		install.ReleaseName = rel.Name
+		install.Namespace = rel.Namespace
+		install.DryRun = true
+		res, err = install.Run(chart, vals)
+	} else {
+		upgrade := action.NewUpgrade(cfg)
+		upgrade.Namespace = rel.Namespace
+		upgrade.DryRun = true
+		res, err = upgrade.Run(rel.Name, chart, vals)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Split(rel.Chart, []byte(res.Manifest)), nil
+}
+
+// Load a release chart and merge its values.
+func loadChart(rel HelmRelease) (*chart.Chart, map[string]interface{}, error) {
+	ch, err := loader.Load(rel.Chart)
+	if err != nil {
+		return nil, nil, err
+	}
+	vals := map[string]interface{}{}
+	for _, f := range rel.ValuesFiles {
+		v, err := chartutil.ReadValuesFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		vals = mergeValues(vals, v.AsMap())
+	}
+	for k, v := range rel.Values {
+		vals = mergeValues(vals, dottedValue(k, v))
+	}
+	return ch, vals, nil
+}
+
+// Check if a release has any revisions.
+func releaseInstalled(cfg *action.Configuration, name string) (bool, error) {
+	history := action.NewHistory(cfg)
+	history.Max = 1
+	_, err := history.Run(name)
+	if err == driver.ErrReleaseNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RollbackRelease rolls a Helm release back to its previous revision.
+func RollbackRelease(name, namespace string, wait time.Duration, info ClusterInfo) error {
+	cfg, err := helmConfig(namespace, info)
+	if err != nil {
+		return err
+	}
+	rollback := action.NewRollback(cfg)
+	// Version zero rolls back to the previous revision
+	rollback.Version = 0
+	rollback.Wait = wait > 0
+	rollback.Timeout = wait
+	return rollback.Run(name)
+}
+
+// Create a Helm action config for releases in a namespace of a GKE cluster.
+func helmConfig(namespace string, info ClusterInfo) (*action.Configuration, error) {
+	cfg := new(action.Configuration)
+	getter := &restGetter{config: restConfig(info), namespace: namespace}
+	err := cfg.Init(getter, namespace, helmDriver, func(format string, v ...interface{}) {})
+	return cfg, err
+}
+
+// Merge values recursively, values in src take precedence over dst.
+func mergeValues(dst, src map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(dst))
+	for k, v := range dst {
+		out[k] = v
+	}
+	for k, v := range src {
+		if m, ok := v.(map[string]interface{}); ok {
+			if d, ok := out[k].(map[string]interface{}); ok {
+				out[k] = mergeValues(d, m)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Convert a dotted path like image.tag into nested values.
+func dottedValue(path, value string) map[string]interface{} {
+	keys := strings.Split(path, ".")
+	var v interface{} = value
+	for i := len(keys) - 1; i >= 0; i-- {
+		v = map[string]interface{}{keys[i]: v}
+	}
+	return v.(map[string]interface{})
+}
+
+// restGetter provides Helm with clients for a GKE cluster instead of loading them from kubeconfig.
+type restGetter struct {
+	config    *rest.Config
+	namespace string
+}
+
+func (g *restGetter) ToRESTConfig() (*rest.Config, error) {
+	return g.config, nil
+}
+
+func (g *restGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	client, err := discovery.NewDiscoveryClientForConfig(g.config)
+	if err != nil {
+		return nil, err
+	}
+	return memory.NewMemCacheClient(client), nil
+}
+
+func (g *restGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	client, err := g.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(client)
+	return restmapper.NewShortcutExpander(mapper, client), nil
+}
+
+func (g *restGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	// Only the namespace is read from the kubeconfig, clients use the GKE config
+	return clientcmd.NewDefaultClientConfig(*api.NewConfig(), &clientcmd.ConfigOverrides{
+		Context: api.Context{Namespace: g.namespace},
+	})
+}
@@ -0,0 +1,202 @@
+package web
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// How often a hook Job is checked while it runs.
+const hookRefresh = 2 * time.Second
+
+// How long finished hook Jobs are kept around to be inspected.
+const hookRetention = 24 * time.Hour
+
+// Name of the container running the hook command.
+const hookContainer = "hook"
+
+// HookJob is a Job running a command with the deployed docker image before
+// or after a deploy.
+type HookJob struct {
+	Name      string
+	Namespace string
+	Image     string
+	Command   []string
+	// ConfigMap and Secret loaded into the container, like into the deployed workloads.
+	EnvConfigMap string
+	EnvSecret    string
+	// Workload whose pod spec the Job copies, so the hook runs with the same
+	// service account, volumes and pull secrets. A bare pod spec is used when
+	// it's nil or doesn't exist yet.
+	Workload *Workload
+	// How long the Job can run before it fails.
+	Timeout time.Duration
+}
+
+// HookFailedError is returned when a hook Job fails or runs longer than its timeout.
+type HookFailedError struct {
+	Namespace string
+	Name      string
+	Reason    string
+}
+
+func (e *HookFailedError) Error() string {
+	return fmt.Sprintf("hook job %v in %v namespace failed: %v", e.Name, e.Namespace, e.Reason)
+}
+
+// RunHook creates a hook Job, streams the logs of its pod into lines and
+// waits until the Job completes. The Job isn't retried, a failure or running
+// longer than its timeout returns a HookFailedError.
+func RunHook(hook HookJob, info ClusterInfo, lines chan<- LogLine) error {
+	client, err := newClient(info)
+	if err != nil {
+		return err
+	}
+	backoff := int32(0)
+	deadline := int64(hook.Timeout.Seconds())
+	ttl := int32(hookRetention.Seconds())
+	labels := map[string]string{"app.kubernetes.io/managed-by": FieldManager}
+	spec, err := hookPodSpec(client, hook)
+	if err != nil {
+		return err
+	}
+	job, err := client.BatchV1().Jobs(hook.Namespace).Create(&batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hook.Name,
+			Namespace: hook.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoff,
+			ActiveDeadlineSeconds:   &deadline,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				// Workload labels aren't copied, so Services don't route traffic to hooks
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       *spec,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	selector := metav1.FormatLabelSelector(job.Spec.Selector)
+	// Logs are streamed until the container terminates, wait for them before returning
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	started := make(map[string]bool)
+	for {
+		// The Job is read before its pods, so a finished Job's pods are always streamed
+		job, err = client.BatchV1().Jobs(hook.Namespace).Get(hook.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		pods, err := client.CoreV1().Pods(hook.Namespace).List(metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods.Items {
+			if started[pod.Name] || !containerStarted(pod, hookContainer, false) {
+				continue
+			}
+			started[pod.Name] = true
+			wg.Add(1)
+			go func(pod string) {
+				defer wg.Done()
+				streamContainer(client, hook.Namespace, pod, &corev1.PodLogOptions{Container: hookContainer, Follow: true}, lines)
+			}(pod.Name)
+		}
+		for _, c := range job.Status.Conditions {
+			if c.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch c.Type {
+			case batchv1.JobComplete:
+				return nil
+			case batchv1.JobFailed:
+				return &HookFailedError{Namespace: hook.Namespace, Name: hook.Name, Reason: c.Message}
+			}
+		}
+		time.Sleep(hookRefresh)
+	}
+}
+
+// Build the pod spec of a hook Job from the pod spec of the hook's workload.
+// Only the workload's main container is kept, since sidecars would keep the
+// Job running, and it runs the hook command with the deployed image.
+func hookPodSpec(client *kubernetes.Clientset, hook HookJob) (*corev1.PodSpec, error) {
+	spec := &corev1.PodSpec{}
+	main := corev1.Container{}
+	if hook.Workload != nil {
+		_, ws, err := getWorkload(client, *hook.Workload)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil {
+			spec = ws.DeepCopy()
+			main = mainContainer(spec.Containers, hook.Workload.Containers)
+			// Init containers running the deployed image get the new version
+			setImages(spec, Workload{Kind: hook.Workload.Kind, Name: hook.Workload.Name, InitContainers: hook.Workload.InitContainers}, hook.Image)
+		}
+	}
+	main.Name = hookContainer
+	main.Image = hook.Image
+	main.Command = hook.Command
+	main.Args = nil
+	// Probes and lifecycle hooks are meant for the long running workload
+	main.LivenessProbe = nil
+	main.ReadinessProbe = nil
+	main.Lifecycle = nil
+	main.EnvFrom = hookEnv(hook, main.EnvFrom)
+	spec.Containers = []corev1.Container{main}
+	spec.RestartPolicy = corev1.RestartPolicyNever
+	return spec, nil
+}
+
+// The container running the deployed image, the first one when the workload
+// doesn't name its containers.
+func mainContainer(containers []corev1.Container, names []string) corev1.Container {
+	for _, c := range containers {
+		if len(names) > 0 && c.Name == names[0] {
+			return c
+		}
+	}
+	if len(containers) > 0 {
+		return containers[0]
+	}
+	return corev1.Container{}
+}
+
+// Add the environment ConfigMap and Secret loaded into the hook container to
+// the sources the container already loads.
+func hookEnv(hook HookJob, env []corev1.EnvFromSource) []corev1.EnvFromSource {
+	for _, e := range env {
+		if e.ConfigMapRef != nil && e.ConfigMapRef.Name == hook.EnvConfigMap {
+			hook.EnvConfigMap = ""
+		}
+		if e.SecretRef != nil && e.SecretRef.Name == hook.EnvSecret {
+			hook.EnvSecret = ""
+		}
+	}
+	if len(hook.EnvConfigMap) > 0 {
+		env = append(env, corev1.EnvFromSource{
+			ConfigMapRef: &corev1.ConfigMapEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: hook.EnvConfigMap},
+			},
+		})
+	}
+	if len(hook.EnvSecret) > 0 {
+		env = append(env, corev1.EnvFromSource{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: hook.EnvSecret},
+			},
+		})
+	}
+	return env
+}
@@ -3,8 +3,7 @@ package web
 import (
 	"fmt"
 
-	"k8s.io/api/extensions/v1beta1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes"
 
 	// Needed to add support for GCP authentication
@@ -14,78 +13,177 @@ import (
 	"k8s.io/client-go/util/retry"
 )
 
-// UpdateDeployment updates a deployment object by adding a new docker image value
-// and triggering a rolling deployment in the process.
-func UpdateDeployment(namespace, name, container, docker string, info ClusterInfo) error {
-	client, err := kubernetes.NewForConfig(&rest.Config{
-		Host:     "https://" + info.Endpoint,
-		Username: info.Username,
-		Password: info.Password,
-		AuthProvider: &api.AuthProviderConfig{
-			Name: "gcp",
-		},
-		TLSClientConfig: rest.TLSClientConfig{
-			Insecure: false,
-			CertData: info.CertData,
-			CAData:   info.CAData,
-			KeyData:  info.KeyData,
-		},
-	})
+// Kinds of workloads which can run the deployed docker image.
+const (
+	DeploymentKind  = "Deployment"
+	StatefulSetKind = "StatefulSet"
+	DaemonSetKind   = "DaemonSet"
+	CronJobKind     = "CronJob"
+	JobKind         = "Job"
+)
+
+// WorkloadKinds lists the supported workload kinds.
+var WorkloadKinds = []string{DeploymentKind, StatefulSetKind, DaemonSetKind, CronJobKind, JobKind}
+
+// Workload is a Kubernetes object whose containers run the deployed docker image.
+type Workload struct {
+	Kind           string
+	Namespace      string
+	Name           string
+	Containers     []string
+	InitContainers []string
+	// ConfigMap loaded into the containers when updated, together with its checksum.
+	EnvConfigMap string
+	EnvChecksum  string
+	// Secret loaded into the containers when updated, together with its checksum.
+	EnvSecret       string
+	SecretsChecksum string
+}
+
+// NotFoundError is returned when a workload doesn't exist in the cluster.
+type NotFoundError struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%v %v not found in %v namespace", e.Kind, e.Name, e.Namespace)
+}
+
+// ContainerNotFoundError is returned when a workload's pod template doesn't
+// define a container which should run the deployed image.
+type ContainerNotFoundError struct {
+	Kind      string
+	Workload  string
+	Container string
+	Init      bool
+}
+
+func (e *ContainerNotFoundError) Error() string {
+	if e.Init {
+		return fmt.Sprintf("init container spec for %v not found in %v %v", e.Container, e.Kind, e.Workload)
+	}
+	return fmt.Sprintf("container spec for %v not found in %v %v", e.Container, e.Kind, e.Workload)
+}
+
+// JobFailedError is returned when a job deployed with the new image fails.
+type JobFailedError struct {
+	Namespace string
+	Name      string
+}
+
+func (e *JobFailedError) Error() string {
+	return fmt.Sprintf("job %v in %v namespace failed", e.Name, e.Namespace)
+}
+
+// ProgressDeadlineError is returned when a Deployment rollout doesn't make
+// progress within its progress deadline.
+type ProgressDeadlineError struct {
+	Namespace string
+	Name      string
+}
+
+func (e *ProgressDeadlineError) Error() string {
+	return fmt.Sprintf("deployment %v in %v namespace exceeded its progress deadline", e.Name, e.Namespace)
+}
+
+// RollbackUnsupportedError is returned when a workload kind keeps no
+// revision history to roll back to.
+type RollbackUnsupportedError struct {
+	Kind string
+	Name string
+}
+
+func (e *RollbackUnsupportedError) Error() string {
+	return fmt.Sprintf("%v %v can't be rolled back", e.Kind, e.Name)
+}
+
+// UpdateWorkloads sets a new docker image on the containers of all workloads
+// and triggers rollouts in the process. All workloads are checked before any
+// of them is changed and if updating one of them fails, the images of the
+// already updated workloads are restored so they keep running the same image.
+func UpdateWorkloads(workloads []Workload, docker string, info ClusterInfo) error {
+	client, err := newClient(info)
 	if err != nil {
 		return err
 	}
-	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		// Retrieve the latest version of Deployment before attempting update
-		// RetryOnConflict uses exponential backoff to avoid exhausting the apiserver
-		res, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	// Verify all workloads and containers exist before changing any of them
+	for _, w := range workloads {
+		_, spec, err := getWorkload(client, w)
 		if err != nil {
+			return workloadError(err, w)
+		}
+		if _, err := setImages(spec, w, docker); err != nil {
 			return err
 		}
-		found := false
-		for i, c := range res.Spec.Template.Spec.Containers {
-			if c.Name == container {
-				res.Spec.Template.Spec.Containers[i].Image = docker
-				found = true
+	}
+	var updated []Workload
+	var previous []map[string]string
+	for _, w := range workloads {
+		var prev map[string]string
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			// Retrieve the latest version of the workload before attempting update
+			// RetryOnConflict uses exponential backoff to avoid exhausting the apiserver
+			obj, spec, err := getWorkload(client, w)
+			if err != nil {
+				return err
 			}
+			prev, err = setImages(spec, w, docker)
+			if err != nil {
+				return err
+			}
+			setEnvFrom(obj, spec, w)
+			return putWorkload(client, obj)
+		})
+		if err != nil {
+			// Restoring is best effort, the update error is more relevant to the user
+			for i := len(updated) - 1; i >= 0; i-- {
+				restoreImages(client, updated[i], previous[i])
+			}
+			return workloadError(err, w)
 		}
-		if !found {
-			return fmt.Errorf("container spec for %v not found in %v deployment", container, name)
-		}
-		_, err = client.AppsV1().Deployments(namespace).Update(res)
-		return err
-	})
-	return err
+		updated = append(updated, w)
+		previous = append(previous, prev)
+	}
+	return nil
 }
 
-// UnavailableReplicas returns the number of unavailable deployment instances for a given deployment.
-func UnavailableReplicas(namespace, name string, info ClusterInfo) (int32, error) {
-	client, err := kubernetes.NewForConfig(&rest.Config{
-		Host:     "https://" + info.Endpoint,
-		Username: info.Username,
-		Password: info.Password,
-		AuthProvider: &api.AuthProviderConfig{
-			Name: "gcp",
-		},
-		TLSClientConfig: rest.TLSClientConfig{
-			Insecure: false,
-			CertData: info.CertData,
-			CAData:   info.CAData,
-			KeyData:  info.KeyData,
-		},
-	})
+// RolloutComplete checks if all pods of a workload run its latest pod template.
+// CronJobs are complete once updated, jobs once they succeed.
+func RolloutComplete(w Workload, info ClusterInfo) (bool, error) {
+	client, err := newClient(info)
 	if err != nil {
-		return -1, err
+		return false, err
 	}
-	res, err := client.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	done, err := rolloutComplete(client, w)
 	if err != nil {
-		return -1, err
+		return false, workloadError(err, w)
 	}
-	return res.Status.UnavailableReplicas, nil
+	return done, nil
 }
 
-// RollbackDeployment reverts the deployment back to its previous state.
-func RollbackDeployment(namespace, name string, info ClusterInfo) error {
-	client, err := kubernetes.NewForConfig(&rest.Config{
+// RollbackWorkload reverts the workload back to its previous pod template.
+// Deployments, StatefulSets and DaemonSets can be rolled back.
+func RollbackWorkload(w Workload, info ClusterInfo) error {
+	client, err := newClient(info)
+	if err != nil {
+		return err
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return rollbackWorkload(client, w)
+	})
+	return workloadError(err, w)
+}
+
+// Create a Kubernetes client for a GKE cluster.
+func newClient(info ClusterInfo) (*kubernetes.Clientset, error) {
+	return kubernetes.NewForConfig(restConfig(info))
+}
+
+// Connection config of a GKE cluster.
+func restConfig(info ClusterInfo) *rest.Config {
+	return &rest.Config{
 		Host:     "https://" + info.Endpoint,
 		Username: info.Username,
 		Password: info.Password,
@@ -98,14 +196,28 @@ func RollbackDeployment(namespace, name string, info ClusterInfo) error {
 			CAData:   info.CAData,
 			KeyData:  info.KeyData,
 		},
-	})
-	if err != nil {
-		return err
 	}
-	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		return client.ExtensionsV1beta1().Deployments(namespace).Rollback(&v1beta1.DeploymentRollback{
-			Name: name,
-		})
+}
+
+// Set the workload's containers back to their previous images.
+func restoreImages(client *kubernetes.Clientset, w Workload, prev map[string]string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, spec, err := getWorkload(client, w)
+		if err != nil {
+			return err
+		}
+		for name, image := range prev {
+			setImage(spec.Containers, name, image, map[string]string{})
+			setImage(spec.InitContainers, name, image, map[string]string{})
+		}
+		return putWorkload(client, obj)
 	})
+}
+
+// Convert API errors about missing workloads into a NotFoundError.
+func workloadError(err error, w Workload) error {
+	if apierrors.IsNotFound(err) {
+		return &NotFoundError{Kind: w.Kind, Namespace: w.Namespace, Name: w.Name}
+	}
 	return err
 }
@@ -0,0 +1,161 @@
+package web
+
+import (
+	"bufio"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// How often pods of a workload are listed while following logs.
+const logsRefresh = 2 * time.Second
+
+// LogOptions selects the logs which are streamed.
+type LogOptions struct {
+	// Container whose logs are streamed, all containers when empty.
+	Container string
+	// Only logs newer than a relative duration, all logs when zero.
+	Since time.Duration
+	// Number of most recent lines to show, all lines when negative.
+	Tail int64
+	// Keep streaming new lines and logs of pods which appear later.
+	Follow bool
+	// Logs of the previous instance of containers which restarted.
+	Previous bool
+}
+
+// LogLine is a line logged by a container, Err is set when the logs of the
+// container couldn't be streamed.
+type LogLine struct {
+	Pod       string
+	Container string
+	Text      string
+	Err       error
+}
+
+// StreamLogs streams logs of all pods of a workload into lines concurrently.
+// Unless logs are followed it returns once all logs are streamed, otherwise
+// it keeps streaming logs of new pods, like the ones created by a rollout.
+func StreamLogs(w Workload, opts LogOptions, info ClusterInfo, lines chan<- LogLine) error {
+	client, err := newClient(info)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	started := make(map[string]bool)
+	for first := true; ; first = false {
+		obj, spec, err := getWorkload(client, w)
+		if err != nil {
+			return workloadError(err, w)
+		}
+		if len(opts.Container) > 0 && !hasContainer(spec, opts.Container) {
+			return &ContainerNotFoundError{Kind: w.Kind, Workload: w.Name, Container: opts.Container}
+		}
+		pods, err := workloadPods(client, obj)
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods {
+			for _, c := range logContainers(pod, opts.Container) {
+				// Containers which restart are streamed again from their new start
+				key := fmt.Sprintf("%v/%v/%v", pod.Name, c, restartCount(pod, c))
+				if started[key] || !containerStarted(pod, c, opts.Previous) {
+					continue
+				}
+				started[key] = true
+				logOpts := &corev1.PodLogOptions{
+					Container: c,
+					Follow:    opts.Follow,
+					Previous:  opts.Previous,
+				}
+				// Pods which appear while following are streamed from their start
+				if first {
+					if opts.Since > 0 {
+						since := int64(opts.Since.Seconds())
+						logOpts.SinceSeconds = &since
+					}
+					if opts.Tail >= 0 {
+						logOpts.TailLines = &opts.Tail
+					}
+				}
+				wg.Add(1)
+				go func(pod, container string) {
+					defer wg.Done()
+					streamContainer(client, w.Namespace, pod, logOpts, lines)
+				}(pod.Name, c)
+			}
+		}
+		if !opts.Follow {
+			return nil
+		}
+		time.Sleep(logsRefresh)
+	}
+}
+
+// Stream logs of a pod container line by line.
+func streamContainer(client *kubernetes.Clientset, namespace, pod string, opts *corev1.PodLogOptions, lines chan<- LogLine) {
+	stream, err := client.CoreV1().Pods(namespace).GetLogs(pod, opts).Stream()
+	if err != nil {
+		lines <- LogLine{Pod: pod, Container: opts.Container, Err: err}
+		return
+	}
+	defer stream.Close()
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines <- LogLine{Pod: pod, Container: opts.Container, Text: scanner.Text()}
+	}
+	if err := scanner.Err(); err != nil {
+		lines <- LogLine{Pod: pod, Container: opts.Container, Err: err}
+	}
+}
+
+// Check if a pod spec has a container or an init container with a name.
+func hasContainer(spec *corev1.PodSpec, name string) bool {
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Names of pod containers whose logs are streamed, init containers only when requested by name.
+func logContainers(pod corev1.Pod, name string) []string {
+	if len(name) > 0 {
+		return []string{name}
+	}
+	var names []string
+	for _, c := range pod.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Number of times a pod container restarted.
+func restartCount(pod corev1.Pod, name string) int32 {
+	for _, c := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if c.Name == name {
+			return c.RestartCount
+		}
+	}
+	return 0
+}
+
+// Check if a container has logs, containers which haven't started yet don't.
+func containerStarted(pod corev1.Pod, name string, previous bool) bool {
+	for _, c := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if c.Name != name {
+			continue
+		}
+		if previous {
+			return c.LastTerminationState.Terminated != nil
+		}
+		return c.State.Running != nil || c.State.Terminated != nil
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/ajdnik/kube-cli/manifest"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// FieldManager owns the fields kube-cli sets with server-side apply.
+const FieldManager = "kube-cli"
+
+// Kinds applied before the others, so objects exist before the workloads using them.
+var applyOrder = []string{
+	"Namespace",
+	"ResourceQuota",
+	"LimitRange",
+	"ServiceAccount",
+	"Secret",
+	"ConfigMap",
+	"PersistentVolumeClaim",
+	"Role",
+	"RoleBinding",
+	"Service",
+}
+
+// AppliedObject identifies an object applied to the cluster.
+type AppliedObject struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// ManifestError is returned when a manifest can't be parsed or applied.
+type ManifestError struct {
+	File string
+	Kind string
+	Name string
+	Err  error
+}
+
+func (e *ManifestError) Error() string {
+	if len(e.Name) > 0 {
+		return fmt.Sprintf("can't apply %v %v from %v: %v", e.Kind, e.Name, e.File, e.Err)
+	}
+	return fmt.Sprintf("can't parse %v: %v", e.File, e.Err)
+}
+
+// ApplyManifests creates or updates objects defined in YAML manifests with
+// server-side apply. Objects without a namespace are applied to namespace and
+// kube-cli takes ownership of conflicting fields set by other managers.
+func ApplyManifests(manifests []manifest.Document, namespace string, info ClusterInfo) ([]AppliedObject, error) {
+	var applied []AppliedObject
+	objs, err := parseManifests(manifests)
+	if err != nil {
+		return applied, err
+	}
+	// Apply dependencies first, the order of other objects is kept
+	order := make([]int, len(objs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return applyRank(objs[order[i]].GetKind()) < applyRank(objs[order[j]].GetKind())
+	})
+	client, err := newClient(info)
+	if err != nil {
+		return applied, err
+	}
+	dyn, mapper, err := newDynamicClient(info)
+	if err != nil {
+		return applied, err
+	}
+	force := true
+	for _, i := range order {
+		obj := objs[i]
+		merr := &ManifestError{File: manifests[i].File, Kind: obj.GetKind(), Name: obj.GetName()}
+		res, err := objectResource(dyn, mapper, obj, namespace)
+		if err != nil {
+			merr.Err = err
+			return applied, merr
+		}
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			merr.Err = err
+			return applied, merr
+		}
+		opts := metav1.PatchOptions{
+			FieldManager: FieldManager,
+			Force:        &force,
+		}
+		_, err = res.Patch(obj.GetName(), types.ApplyPatchType, data, opts)
+		// Job pod templates are immutable, so changed jobs are created again
+		gvk := obj.GroupVersionKind()
+		if apierrors.IsInvalid(err) && gvk.Group == "batch" && gvk.Kind == JobKind {
+			if err = deleteJob(client, obj.GetNamespace(), obj.GetName()); err == nil {
+				_, err = res.Patch(obj.GetName(), types.ApplyPatchType, data, opts)
+			}
+		}
+		if err != nil {
+			merr.Err = err
+			return applied, merr
+		}
+		applied = append(applied, AppliedObject{
+			Kind:      obj.GetKind(),
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+		})
+	}
+	return applied, nil
+}
+
+// Decode YAML manifests into unstructured objects.
+func parseManifests(manifests []manifest.Document) ([]*unstructured.Unstructured, error) {
+	objs := make([]*unstructured.Unstructured, len(manifests))
+	for i, m := range manifests {
+		obj := &unstructured.Unstructured{}
+		err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(m.YAML), 4096).Decode(&obj.Object)
+		if err != nil {
+			return nil, &ManifestError{File: m.File, Err: err}
+		}
+		if len(obj.GetKind()) == 0 || len(obj.GetName()) == 0 {
+			return nil, &ManifestError{File: m.File, Err: fmt.Errorf("kind and metadata.name are required")}
+		}
+		objs[i] = obj
+	}
+	return objs, nil
+}
+
+// Create a dynamic client and a mapper of kinds to resources served by the cluster.
+func newDynamicClient(info ClusterInfo) (dynamic.Interface, meta.RESTMapper, error) {
+	client, err := newClient(info)
+	if err != nil {
+		return nil, nil, err
+	}
+	dyn, err := dynamic.NewForConfig(restConfig(info))
+	if err != nil {
+		return nil, nil, err
+	}
+	resources, err := restmapper.GetAPIGroupResources(client.Discovery())
+	if err != nil {
+		return nil, nil, err
+	}
+	return dyn, restmapper.NewDiscoveryRESTMapper(resources), nil
+}
+
+// Resource client of an object, namespaced objects without a namespace are put into namespace.
+func objectResource(dyn dynamic.Interface, mapper meta.RESTMapper, obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return dyn.Resource(mapping.Resource), nil
+	}
+	if len(obj.GetNamespace()) == 0 {
+		obj.SetNamespace(namespace)
+	}
+	return dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace()), nil
+}
+
+// Position of a kind in the apply order, kinds which aren't listed go last.
+func applyRank(kind string) int {
+	for i, k := range applyOrder {
+		if k == kind {
+			return i
+		}
+	}
+	return len(applyOrder)
+}
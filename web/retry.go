@@ -0,0 +1,21 @@
+package web
+
+import "time"
+
+// Run an operation until it succeeds, fails with an error which isn't retryable
+// or runs out of attempts, doubling the delay between attempts.
+func withRetry(attempts int, retryable func(error) bool, op func() error) error {
+	var err error
+	backoff := time.Second
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = op()
+		if err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
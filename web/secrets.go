@@ -0,0 +1,228 @@
+package web
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Secret Manager API endpoint overridden in tests, requests to an overridden
+// endpoint aren't authenticated so it can point to a fake server.
+var secretManagerEndpoint string
+
+// Secret Manager version state of versions which can be accessed.
+const enabledSecretVersion = "ENABLED"
+
+// SecretNotFoundError is returned when a secret or its version doesn't exist in Secret Manager.
+type SecretNotFoundError struct {
+	Secret  string
+	Version string
+}
+
+func (e *SecretNotFoundError) Error() string {
+	return fmt.Sprintf("secret %v version %v doesn't exist", e.Secret, e.Version)
+}
+
+// SecretVersion describes a version of a Secret Manager secret, never its value.
+type SecretVersion struct {
+	Secret  string
+	Version string
+	State   string
+	Created time.Time
+}
+
+// LatestSecretVersion returns the latest enabled version of a secret.
+func LatestSecretVersion(project, secret string) (SecretVersion, error) {
+	latest := SecretVersion{Secret: secret}
+	ctx := context.Background()
+	svc, err := secretManager(ctx)
+	if err != nil {
+		return latest, err
+	}
+	parent := fmt.Sprintf("projects/%v/secrets/%v", project, secret)
+	err = svc.Projects.Secrets.Versions.List(parent).Pages(ctx, func(res *secretmanager.ListSecretVersionsResponse) error {
+		for _, v := range res.Versions {
+			if v.State != enabledSecretVersion {
+				continue
+			}
+			version := toSecretVersion(secret, v)
+			if version.Created.After(latest.Created) {
+				latest = version
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return latest, secretError(err, secret, "latest")
+	}
+	if len(latest.Version) == 0 {
+		return latest, &SecretNotFoundError{Secret: secret, Version: "latest"}
+	}
+	return latest, nil
+}
+
+// AccessSecret returns the value of a secret version and the version it
+// resolves to, the latest version resolves to the newest enabled version.
+func AccessSecret(project, secret, version string) ([]byte, string, error) {
+	ctx := context.Background()
+	svc, err := secretManager(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	name := fmt.Sprintf("projects/%v/secrets/%v/versions/%v", project, secret, version)
+	res, err := svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return nil, "", secretError(err, secret, version)
+	}
+	value, err := base64.StdEncoding.DecodeString(res.Payload.Data)
+	if err != nil {
+		return nil, "", err
+	}
+	return value, path.Base(res.Name), nil
+}
+
+// AddSecretVersion adds a version with a value to a secret and creates the
+// secret when it doesn't exist yet.
+func AddSecretVersion(project, secret string, value []byte) (SecretVersion, error) {
+	ctx := context.Background()
+	svc, err := secretManager(ctx)
+	if err != nil {
+		return SecretVersion{Secret: secret}, err
+	}
+	name := fmt.Sprintf("projects/%v/secrets/%v", project, secret)
+	_, err = svc.Projects.Secrets.Get(name).Context(ctx).Do()
+	if isNotFound(err) {
+		_, err = svc.Projects.Secrets.Create(fmt.Sprintf("projects/%v", project), &secretmanager.Secret{
+			Replication: &secretmanager.Replication{Automatic: &secretmanager.Automatic{}},
+			Labels:      map[string]string{"managed-by": FieldManager},
+		}).SecretId(secret).Context(ctx).Do()
+	}
+	if err != nil {
+		return SecretVersion{Secret: secret}, err
+	}
+	v, err := svc.Projects.Secrets.AddVersion(name, &secretmanager.AddSecretVersionRequest{
+		Payload: &secretmanager.SecretPayload{Data: base64.StdEncoding.EncodeToString(value)},
+	}).Context(ctx).Do()
+	if err != nil {
+		return SecretVersion{Secret: secret}, err
+	}
+	return toSecretVersion(secret, v), nil
+}
+
+// DisableSecretVersions disables all enabled versions of a secret except
+// keep and returns how many versions were disabled.
+func DisableSecretVersions(project, secret, keep string) (int, error) {
+	ctx := context.Background()
+	svc, err := secretManager(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var names []string
+	parent := fmt.Sprintf("projects/%v/secrets/%v", project, secret)
+	err = svc.Projects.Secrets.Versions.List(parent).Pages(ctx, func(res *secretmanager.ListSecretVersionsResponse) error {
+		for _, v := range res.Versions {
+			if v.State == enabledSecretVersion && path.Base(v.Name) != keep {
+				names = append(names, v.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, secretError(err, secret, keep)
+	}
+	for i, name := range names {
+		_, err = svc.Projects.Secrets.Versions.Disable(name, &secretmanager.DisableSecretVersionRequest{}).Context(ctx).Do()
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(names), nil
+}
+
+// SyncSecret creates a Kubernetes Secret with data or updates it when its
+// data is different and reports if it was changed.
+func SyncSecret(name, namespace string, data map[string][]byte, info ClusterInfo) (bool, error) {
+	client, err := newClient(info)
+	if err != nil {
+		return false, err
+	}
+	return syncSecret(client, name, namespace, data)
+}
+
+// Create or update a Secret with data using a client and report if it was changed.
+func syncSecret(client kubernetes.Interface, name, namespace string, data map[string][]byte) (bool, error) {
+	changed := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := client.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = client.CoreV1().Secrets(namespace).Create(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+					Labels:    map[string]string{"app.kubernetes.io/managed-by": FieldManager},
+				},
+				Type: corev1.SecretTypeOpaque,
+				Data: data,
+			})
+			changed = err == nil
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(secret.Data, data) {
+			return nil
+		}
+		secret.Data = data
+		_, err = client.CoreV1().Secrets(namespace).Update(secret)
+		changed = err == nil
+		return err
+	})
+	return changed, err
+}
+
+// Create a Secret Manager client, for secretManagerEndpoint when it's set.
+func secretManager(ctx context.Context) (*secretmanager.Service, error) {
+	if len(secretManagerEndpoint) > 0 {
+		return secretmanager.NewService(ctx, option.WithEndpoint(secretManagerEndpoint), option.WithoutAuthentication())
+	}
+	return secretmanager.NewService(ctx)
+}
+
+// Convert a Secret Manager version into a SecretVersion.
+func toSecretVersion(secret string, v *secretmanager.SecretVersion) SecretVersion {
+	created, _ := time.Parse(time.RFC3339Nano, v.CreateTime)
+	return SecretVersion{
+		Secret:  secret,
+		Version: path.Base(v.Name),
+		State:   v.State,
+		Created: created,
+	}
+}
+
+// Convert Secret Manager errors about missing secrets into a SecretNotFoundError.
+func secretError(err error, secret, version string) error {
+	if isNotFound(err) {
+		return &SecretNotFoundError{Secret: secret, Version: version}
+	}
+	return err
+}
+
+// Check if a Google API request failed because the resource doesn't exist.
+func isNotFound(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == http.StatusNotFound
+}
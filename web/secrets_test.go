@@ -0,0 +1,278 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testProject = "test-project"
+
+// fakeVersion is a secret version stored by fakeSecretManager.
+type fakeVersion struct {
+	State   string
+	Created time.Time
+	Data    []byte
+}
+
+// fakeSecretManager is an in-memory Secret Manager API server.
+type fakeSecretManager struct {
+	mu      sync.Mutex
+	secrets map[string][]*fakeVersion
+}
+
+// Start a fake Secret Manager server with secrets and point the client to it,
+// the returned function stops it.
+func startSecretManager(secrets map[string][]*fakeVersion) (*fakeSecretManager, func()) {
+	fsm := &fakeSecretManager{secrets: secrets}
+	srv := httptest.NewServer(fsm)
+	secretManagerEndpoint = srv.URL + "/"
+	return fsm, func() {
+		secretManagerEndpoint = ""
+		srv.Close()
+	}
+}
+
+func (fsm *fakeSecretManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/v1/")
+	action := ""
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name, action = name[:i], name[i+1:]
+	}
+	parts := strings.Split(name, "/")
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "secrets":
+		// Create a secret
+		id := r.URL.Query().Get("secretId")
+		if _, ok := fsm.secrets[id]; ok {
+			writeError(w, http.StatusConflict)
+			return
+		}
+		fsm.secrets[id] = nil
+		writeJSON(w, map[string]string{"name": path.Join(name, id)})
+	case len(parts) == 4 && action == "":
+		// Get a secret
+		if _, ok := fsm.secrets[parts[3]]; !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]string{"name": name})
+	case len(parts) == 4 && action == "addVersion":
+		versions, ok := fsm.secrets[parts[3]]
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		var req struct {
+			Payload struct{ Data string }
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		data, _ := base64.StdEncoding.DecodeString(req.Payload.Data)
+		v := &fakeVersion{State: enabledSecretVersion, Created: time.Now(), Data: data}
+		fsm.secrets[parts[3]] = append(versions, v)
+		writeJSON(w, versionJSON(name, len(versions)+1, v))
+	case len(parts) == 5 && parts[4] == "versions":
+		// List versions of a secret
+		versions, ok := fsm.secrets[parts[3]]
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		var res []interface{}
+		for i, v := range versions {
+			res = append(res, versionJSON(path.Join(parts[:4]...), i+1, v))
+		}
+		writeJSON(w, map[string]interface{}{"versions": res})
+	case len(parts) == 6:
+		versions := fsm.secrets[parts[3]]
+		n := 0
+		if parts[5] == "latest" {
+			for i, v := range versions {
+				if v.State == enabledSecretVersion {
+					n = i + 1
+				}
+			}
+		} else {
+			fmt.Sscan(parts[5], &n)
+		}
+		if n < 1 || n > len(versions) {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		v := versions[n-1]
+		secret := path.Join(parts[:4]...)
+		switch action {
+		case "access":
+			writeJSON(w, map[string]interface{}{
+				"name":    fmt.Sprintf("%v/versions/%v", secret, n),
+				"payload": map[string]string{"data": base64.StdEncoding.EncodeToString(v.Data)},
+			})
+		case "disable":
+			v.State = "DISABLED"
+			writeJSON(w, versionJSON(secret, n, v))
+		default:
+			writeError(w, http.StatusNotFound)
+		}
+	default:
+		writeError(w, http.StatusNotFound)
+	}
+}
+
+// JSON representation of a secret version.
+func versionJSON(secret string, n int, v *fakeVersion) map[string]string {
+	return map[string]string{
+		"name":       fmt.Sprintf("%v/versions/%v", secret, n),
+		"state":      v.State,
+		"createTime": v.Created.Format(time.RFC3339Nano),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": http.StatusText(code)},
+	})
+}
+
+func TestLatestSecretVersionSkipsDisabled(t *testing.T) {
+	now := time.Now()
+	_, stop := startSecretManager(map[string][]*fakeVersion{
+		"db-password": {
+			{State: enabledSecretVersion, Created: now.Add(-2 * time.Hour)},
+			{State: enabledSecretVersion, Created: now.Add(-time.Hour)},
+			{State: "DISABLED", Created: now},
+		},
+	})
+	defer stop()
+	v, err := LatestSecretVersion(testProject, "db-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != "2" {
+		t.Errorf("expected version 2, got %v", v.Version)
+	}
+	_, err = LatestSecretVersion(testProject, "missing")
+	if _, ok := err.(*SecretNotFoundError); !ok {
+		t.Errorf("expected SecretNotFoundError, got %v", err)
+	}
+}
+
+func TestAccessSecretResolvesLatest(t *testing.T) {
+	_, stop := startSecretManager(map[string][]*fakeVersion{
+		"db-password": {
+			{State: enabledSecretVersion, Created: time.Now(), Data: []byte("old")},
+			{State: enabledSecretVersion, Created: time.Now(), Data: []byte("new")},
+		},
+	})
+	defer stop()
+	value, version, err := AccessSecret(testProject, "db-password", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "new" || version != "2" {
+		t.Errorf("expected new at version 2, got %v at version %v", string(value), version)
+	}
+	value, version, err = AccessSecret(testProject, "db-password", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "old" || version != "1" {
+		t.Errorf("expected old at version 1, got %v at version %v", string(value), version)
+	}
+	_, _, err = AccessSecret(testProject, "db-password", "3")
+	if _, ok := err.(*SecretNotFoundError); !ok {
+		t.Errorf("expected SecretNotFoundError, got %v", err)
+	}
+}
+
+func TestAddSecretVersionCreatesSecret(t *testing.T) {
+	fsm, stop := startSecretManager(map[string][]*fakeVersion{})
+	defer stop()
+	v, err := AddSecretVersion(testProject, "api-key", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != "1" || v.State != enabledSecretVersion {
+		t.Errorf("expected enabled version 1, got %v version %v", v.State, v.Version)
+	}
+	versions := fsm.secrets["api-key"]
+	if len(versions) != 1 || string(versions[0].Data) != "value" {
+		t.Errorf("expected secret to be created with the value")
+	}
+}
+
+func TestDisableSecretVersionsKeepsVersion(t *testing.T) {
+	fsm, stop := startSecretManager(map[string][]*fakeVersion{
+		"api-key": {
+			{State: enabledSecretVersion, Created: time.Now()},
+			{State: "DISABLED", Created: time.Now()},
+			{State: enabledSecretVersion, Created: time.Now()},
+			{State: enabledSecretVersion, Created: time.Now()},
+		},
+	})
+	defer stop()
+	n, err := DisableSecretVersions(testProject, "api-key", "4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 disabled versions, got %v", n)
+	}
+	for i, v := range fsm.secrets["api-key"] {
+		enabled := v.State == enabledSecretVersion
+		if enabled != (i == 3) {
+			t.Errorf("version %v has unexpected state %v", i+1, v.State)
+		}
+	}
+}
+
+func TestSyncSecret(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	data := map[string][]byte{"DB_PASSWORD": []byte("secret")}
+	changed, err := syncSecret(client, "api-secrets", "default", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("expected the Secret to be created")
+	}
+	changed, err = syncSecret(client, "api-secrets", "default", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("expected the Secret not to change")
+	}
+	changed, err = syncSecret(client, "api-secrets", "default", map[string][]byte{"DB_PASSWORD": []byte("rotated")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("expected the Secret to be updated")
+	}
+	secret, err := client.CoreV1().Secrets("default").Get("api-secrets", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["DB_PASSWORD"]) != "rotated" {
+		t.Errorf("expected rotated value, got %v", string(secret.Data["DB_PASSWORD"]))
+	}
+}
@@ -0,0 +1,227 @@
+package web
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// How many of the most recent events are part of a workload status.
+const statusEvents = 10
+
+// WorkloadStatus describes the current state of a workload and its pods.
+type WorkloadStatus struct {
+	Workload Workload
+	// Revision of the pod template, empty for kinds without revisions.
+	Revision   string
+	Images     []ContainerImage
+	Desired    int32
+	Updated    int32
+	Ready      int32
+	Available  int32
+	Conditions []Condition
+	Pods       []PodStatus
+	// Most recent events of the workload, the oldest first.
+	Events []Event
+}
+
+// ContainerImage is the docker image of a container in a pod template.
+type ContainerImage struct {
+	Container string
+	Image     string
+	Init      bool
+}
+
+// Condition is a rollout condition of a workload.
+type Condition struct {
+	Type    string
+	Status  string
+	Reason  string
+	Message string
+}
+
+// PodStatus describes a pod of a workload.
+type PodStatus struct {
+	Name string
+	// Phase of the pod or the reason its containers aren't running, like kubectl shows.
+	Status     string
+	Ready      int
+	Containers int
+	Restarts   int32
+	Created    time.Time
+}
+
+// Event is a Kubernetes event about a workload.
+type Event struct {
+	Type    string
+	Reason  string
+	Message string
+	Count   int32
+	Last    time.Time
+}
+
+// GetWorkloadStatus retrieves the images, replica counts, conditions, pods and
+// recent events of a workload.
+func GetWorkloadStatus(w Workload, info ClusterInfo) (WorkloadStatus, error) {
+	status := WorkloadStatus{Workload: w}
+	client, err := newClient(info)
+	if err != nil {
+		return status, err
+	}
+	obj, spec, err := getWorkload(client, w)
+	if err != nil {
+		return status, workloadError(err, w)
+	}
+	for _, c := range spec.InitContainers {
+		status.Images = append(status.Images, ContainerImage{Container: c.Name, Image: c.Image, Init: true})
+	}
+	for _, c := range spec.Containers {
+		status.Images = append(status.Images, ContainerImage{Container: c.Name, Image: c.Image})
+	}
+	switch res := obj.(type) {
+	case *appsv1.Deployment:
+		status.Revision = res.Annotations["deployment.kubernetes.io/revision"]
+		status.Desired = replicas(res.Spec.Replicas)
+		status.Updated = res.Status.UpdatedReplicas
+		status.Ready = res.Status.ReadyReplicas
+		status.Available = res.Status.AvailableReplicas
+		for _, c := range res.Status.Conditions {
+			status.Conditions = append(status.Conditions, Condition{Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Message: c.Message})
+		}
+	case *appsv1.StatefulSet:
+		status.Revision = res.Status.UpdateRevision
+		status.Desired = replicas(res.Spec.Replicas)
+		status.Updated = res.Status.UpdatedReplicas
+		status.Ready = res.Status.ReadyReplicas
+		status.Available = res.Status.ReadyReplicas
+		for _, c := range res.Status.Conditions {
+			status.Conditions = append(status.Conditions, Condition{Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Message: c.Message})
+		}
+	case *appsv1.DaemonSet:
+		status.Desired = res.Status.DesiredNumberScheduled
+		status.Updated = res.Status.UpdatedNumberScheduled
+		status.Ready = res.Status.NumberReady
+		status.Available = res.Status.NumberAvailable
+		for _, c := range res.Status.Conditions {
+			status.Conditions = append(status.Conditions, Condition{Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Message: c.Message})
+		}
+	case *batchv1.Job:
+		status.Desired = replicas(res.Spec.Completions)
+		status.Updated = res.Status.Active + res.Status.Succeeded
+		status.Ready = res.Status.Active
+		status.Available = res.Status.Succeeded
+		for _, c := range res.Status.Conditions {
+			status.Conditions = append(status.Conditions, Condition{Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Message: c.Message})
+		}
+	case *batchv1beta1.CronJob:
+		status.Ready = int32(len(res.Status.Active))
+	}
+	pods, err := workloadPods(client, obj)
+	if err != nil {
+		return status, err
+	}
+	for _, p := range pods {
+		status.Pods = append(status.Pods, podStatus(p))
+	}
+	status.Events, err = workloadEvents(client, w)
+	return status, err
+}
+
+// Retrieve the pods of a workload retrieved by getWorkload, sorted by name.
+func workloadPods(client *kubernetes.Clientset, obj interface{}) ([]corev1.Pod, error) {
+	var namespace, selector string
+	switch res := obj.(type) {
+	case *appsv1.Deployment:
+		namespace, selector = res.Namespace, metav1.FormatLabelSelector(res.Spec.Selector)
+	case *appsv1.StatefulSet:
+		namespace, selector = res.Namespace, metav1.FormatLabelSelector(res.Spec.Selector)
+	case *appsv1.DaemonSet:
+		namespace, selector = res.Namespace, metav1.FormatLabelSelector(res.Spec.Selector)
+	case *batchv1.Job:
+		namespace, selector = res.Namespace, metav1.FormatLabelSelector(res.Spec.Selector)
+	case *batchv1beta1.CronJob:
+		// Only pods of the jobs which are currently running
+		if len(res.Status.Active) == 0 {
+			return nil, nil
+		}
+		var jobs []string
+		for _, j := range res.Status.Active {
+			jobs = append(jobs, j.Name)
+		}
+		namespace, selector = res.Namespace, fmt.Sprintf("job-name in (%v)", strings.Join(jobs, ","))
+	}
+	list, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	pods := list.Items
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, nil
+}
+
+// Summarize the state of a pod.
+func podStatus(pod corev1.Pod) PodStatus {
+	status := PodStatus{
+		Name:       pod.Name,
+		Status:     string(pod.Status.Phase),
+		Containers: len(pod.Spec.Containers),
+		Created:    pod.CreationTimestamp.Time,
+	}
+	if len(pod.Status.Reason) > 0 {
+		status.Status = pod.Status.Reason
+	}
+	for _, c := range pod.Status.ContainerStatuses {
+		status.Restarts += c.RestartCount
+		if c.Ready {
+			status.Ready++
+		}
+		// Like kubectl, show why a container isn't running instead of the phase
+		if c.State.Waiting != nil && len(c.State.Waiting.Reason) > 0 {
+			status.Status = c.State.Waiting.Reason
+		} else if c.State.Terminated != nil && len(c.State.Terminated.Reason) > 0 && pod.Status.Phase == corev1.PodRunning {
+			status.Status = c.State.Terminated.Reason
+		}
+	}
+	if pod.DeletionTimestamp != nil {
+		status.Status = "Terminating"
+	}
+	return status
+}
+
+// Retrieve the most recent events of a workload, the oldest first.
+func workloadEvents(client *kubernetes.Clientset, w Workload) ([]Event, error) {
+	selector := fields.Set{
+		"involvedObject.kind": w.Kind,
+		"involvedObject.name": w.Name,
+	}.AsSelector().String()
+	list, err := client.CoreV1().Events(w.Namespace).List(metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	for _, e := range list.Items {
+		last := e.LastTimestamp.Time
+		if last.IsZero() {
+			last = e.EventTime.Time
+		}
+		events = append(events, Event{Type: e.Type, Reason: e.Reason, Message: e.Message, Count: e.Count, Last: last})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Last.Before(events[j].Last)
+	})
+	if len(events) > statusEvents {
+		events = events[len(events)-statusEvents:]
+	}
+	return events, nil
+}
@@ -1,25 +1,218 @@
 package web
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"errors"
+	"hash/crc32"
 	"io"
+	"net"
+	"net/http"
 	"os"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 )
 
+const (
+	// Size of the chunks sent in each request of a resumable upload.
+	uploadChunkSize = 8 * 1024 * 1024
+	// Number of attempts made to upload a file before giving up.
+	uploadAttempts = 4
+)
+
+// Returned when the uploaded object doesn't match the local data.
+var errChecksumMismatch = errors.New("upload verification failed, checksum mismatch")
+
+// StorageObject represents an object stored in a Google Storage bucket.
+type StorageObject struct {
+	Name    string
+	Size    int64
+	Created time.Time
+}
+
+// BucketOptions configures a bucket created on Google Storage.
+type BucketOptions struct {
+	// Location of the bucket, uses the default multi-region when empty.
+	Location string
+	// Cloud KMS key used to encrypt objects by default, uses Google-managed keys when empty.
+	KMSKey string
+	// Number of days after which objects are deleted, zero keeps them forever.
+	RetentionDays int
+}
+
+var (
+	// ErrBucketForbidden is returned when the credentials aren't allowed to access a bucket.
+	ErrBucketForbidden = errors.New("access to bucket forbidden")
+	// ErrBucketNotOwned is returned when a bucket exists but belongs to a different project.
+	ErrBucketNotOwned = errors.New("bucket belongs to a different project")
+)
+
+// EnsureBucket makes sure a bucket owned by the project exists on Google Storage,
+// creating it when missing. It returns true if the bucket was created.
+func EnsureBucket(bucket, project string, opts BucketOptions) (bool, error) {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return false, err
+	}
+	_, err = client.Bucket(bucket).Attrs(ctx)
+	if err == storage.ErrBucketNotExist {
+		err = CreateBucket(bucket, project, opts)
+		if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusConflict {
+			// Bucket names are global, it was created in the meantime by this
+			// project or by someone else
+			return false, bucketOwner(ctx, client, bucket, project)
+		}
+		if err != nil {
+			return false, storageError(err)
+		}
+		return true, nil
+	}
+	if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusForbidden {
+		// Buckets of other projects usually can't be read at all
+		if oerr := bucketOwner(ctx, client, bucket, project); oerr != nil {
+			return false, oerr
+		}
+		return false, ErrBucketForbidden
+	}
+	if err != nil {
+		return false, storageError(err)
+	}
+	return false, bucketOwner(ctx, client, bucket, project)
+}
+
+// Make sure a bucket is listed among the project buckets, since bucket names
+// are global. It returns ErrBucketNotOwned when it isn't.
+func bucketOwner(ctx context.Context, client *storage.Client, bucket, project string) error {
+	it := client.Buckets(ctx, project)
+	it.Prefix = bucket
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return ErrBucketNotOwned
+		}
+		if err != nil {
+			return storageError(err)
+		}
+		if attrs.Name == bucket {
+			return nil
+		}
+	}
+}
+
 // CreateBucket creates a new bucket on Google Storage.
-func CreateBucket(bucket, project string) error {
+func CreateBucket(bucket, project string, opts BucketOptions) error {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	attrs := &storage.BucketAttrs{
+		Location: opts.Location,
+	}
+	if len(opts.KMSKey) > 0 {
+		attrs.Encryption = &storage.BucketEncryption{
+			DefaultKMSKeyName: opts.KMSKey,
+		}
+	}
+	if opts.RetentionDays > 0 {
+		attrs.Lifecycle = storage.Lifecycle{
+			Rules: []storage.LifecycleRule{
+				{
+					Action:    storage.LifecycleAction{Type: storage.DeleteAction},
+					Condition: storage.LifecycleCondition{AgeInDays: int64(opts.RetentionDays)},
+				},
+			},
+		}
+	}
+	return client.Bucket(bucket).Create(ctx, project, attrs)
+}
+
+// Convert permission errors returned by Google Storage into ErrBucketForbidden.
+func storageError(err error) error {
+	if gerr, ok := err.(*googleapi.Error); ok && (gerr.Code == http.StatusForbidden || gerr.Code == http.StatusUnauthorized) {
+		return ErrBucketForbidden
+	}
+	return err
+}
+
+// ListObjects returns all objects in a Google Storage bucket.
+func ListObjects(bucket string) ([]StorageObject, error) {
+	var objs []StorageObject
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return objs, err
+	}
+	it := client.Bucket(bucket).Objects(ctx, nil)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return objs, err
+		}
+		objs = append(objs, StorageObject{
+			Name:    attrs.Name,
+			Size:    attrs.Size,
+			Created: attrs.Created,
+		})
+	}
+	return objs, nil
+}
+
+// DeleteObject removes an object from a Google Storage bucket.
+func DeleteObject(bucket, object string) error {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	return client.Bucket(bucket).Object(object).Delete(ctx)
+}
+
+// ObjectExists checks if an object exists in a Google Storage bucket.
+func ObjectExists(bucket, object string) (bool, error) {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return false, err
+	}
+	_, err = client.Bucket(bucket).Object(object).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// TouchObject rewrites an object in place, so its creation time, which archive
+// expiry and bucket lifecycle rules are based on, becomes the current time.
+func TouchObject(bucket, object string) error {
 	ctx := context.Background()
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return err
 	}
-	return client.Bucket(bucket).Create(ctx, project, nil)
+	obj := client.Bucket(bucket).Object(object)
+	copier := obj.CopierFrom(obj)
+	// Objects can only be rewritten onto themselves when their metadata changes
+	copier.Metadata = map[string]string{"kube-cli-deployed": time.Now().UTC().Format(time.RFC3339)}
+	_, err = copier.Run(ctx)
+	return err
 }
 
-// StorageUpload uploads a local file to Google Storage bucket.
-func StorageUpload(bucket, object, local string) (int64, error) {
+// StorageUpload uploads a local file to Google Storage bucket. The upload
+// progress is reported to the progress callback, transient failures are retried
+// and the uploaded object is verified against the local file checksums.
+func StorageUpload(bucket, object, local string, progress ProgressFunc) (int64, error) {
 	var size int64
 	ctx := context.Background()
 	client, err := storage.NewClient(ctx)
@@ -36,12 +229,88 @@ func StorageUpload(bucket, object, local string) (int64, error) {
 		return size, err
 	}
 	size = stat.Size()
-	wc := client.Bucket(bucket).Object(object).NewWriter(ctx)
-	if _, err = io.Copy(wc, f); err != nil {
+	obj := client.Bucket(bucket).Object(object)
+	err = withRetry(uploadAttempts, retryableStorage, func() error {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := uploadObject(ctx, obj, f, size, progress)
+		return err
+	})
+	return size, err
+}
+
+// StorageStream uploads data produced by the write function to Google Storage
+// bucket without buffering it on disk. The data is streamed through a pipe
+// while it's being written and the write function is called again whenever
+// the upload has to be retried.
+func StorageStream(bucket, object string, write func(io.Writer) error, progress ProgressFunc) (int64, error) {
+	var size int64
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
 		return size, err
 	}
+	obj := client.Bucket(bucket).Object(object)
+	err = withRetry(uploadAttempts, retryableStorage, func() error {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(write(pw))
+		}()
+		var err error
+		size, err = uploadObject(ctx, obj, pr, -1, progress)
+		// Unblock the writer in case the upload stopped before reading everything
+		pr.CloseWithError(err)
+		return err
+	})
+	return size, err
+}
+
+// Upload the reader contents to an object and compare the checksums computed
+// by Google Storage with the checksums of the uploaded data. The size is
+// only used to report progress and is -1 when unknown.
+func uploadObject(ctx context.Context, obj *storage.ObjectHandle, r io.Reader, size int64, progress ProgressFunc) (int64, error) {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wc := obj.NewWriter(wctx)
+	wc.ChunkSize = uploadChunkSize
+	if progress != nil {
+		progress(0, size)
+		wc.ProgressFunc = func(done int64) {
+			progress(done, size)
+		}
+	}
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	md := md5.New()
+	n, err := io.Copy(io.MultiWriter(wc, crc, md), r)
+	if err != nil {
+		// Canceling the context aborts the upload without creating the object
+		cancel()
+		wc.Close()
+		return n, err
+	}
 	if err := wc.Close(); err != nil {
-		return size, err
+		return n, err
+	}
+	if progress != nil {
+		progress(n, n)
+	}
+	attrs := wc.Attrs()
+	if attrs.CRC32C != crc.Sum32() || (len(attrs.MD5) > 0 && !bytes.Equal(attrs.MD5, md.Sum(nil))) {
+		// Remove the corrupt object so it can't be used by a build
+		obj.Delete(ctx)
+		return n, errChecksumMismatch
+	}
+	return n, nil
+}
+
+// Decide whether a failed Google Storage operation should be retried.
+func retryableStorage(err error) bool {
+	if gerr, ok := err.(*googleapi.Error); ok {
+		return gerr.Code >= 500 || gerr.Code == http.StatusTooManyRequests
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
 	}
-	return size, nil
+	return err == io.ErrUnexpectedEOF || err == errChecksumMismatch
 }
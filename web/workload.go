@@ -0,0 +1,296 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// How long to wait for a replaced job to be deleted.
+const jobDeleteTimeout = 2 * time.Minute
+
+// Reason of the Progressing condition of a Deployment whose rollout is stuck.
+const progressDeadlineExceeded = "ProgressDeadlineExceeded"
+
+// Labels generated by the job controller which can't be reused by a new job.
+var jobControllerLabels = []string{"controller-uid", "job-name"}
+
+var errNoPreviousRevision = errors.New("there is no previous revision to roll back to")
+
+// Retrieve a workload and the pod spec of its containers.
+func getWorkload(client *kubernetes.Clientset, w Workload) (interface{}, *corev1.PodSpec, error) {
+	switch w.Kind {
+	case StatefulSetKind:
+		res, err := client.AppsV1().StatefulSets(w.Namespace).Get(w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return res, &res.Spec.Template.Spec, nil
+	case DaemonSetKind:
+		res, err := client.AppsV1().DaemonSets(w.Namespace).Get(w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return res, &res.Spec.Template.Spec, nil
+	case CronJobKind:
+		res, err := client.BatchV1beta1().CronJobs(w.Namespace).Get(w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return res, &res.Spec.JobTemplate.Spec.Template.Spec, nil
+	case JobKind:
+		res, err := client.BatchV1().Jobs(w.Namespace).Get(w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return res, &res.Spec.Template.Spec, nil
+	case DeploymentKind, "":
+		res, err := client.AppsV1().Deployments(w.Namespace).Get(w.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return res, &res.Spec.Template.Spec, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported workload kind %v", w.Kind)
+}
+
+// Save a workload retrieved by getWorkload.
+func putWorkload(client *kubernetes.Clientset, obj interface{}) error {
+	var err error
+	switch res := obj.(type) {
+	case *appsv1.Deployment:
+		_, err = client.AppsV1().Deployments(res.Namespace).Update(res)
+	case *appsv1.StatefulSet:
+		_, err = client.AppsV1().StatefulSets(res.Namespace).Update(res)
+	case *appsv1.DaemonSet:
+		_, err = client.AppsV1().DaemonSets(res.Namespace).Update(res)
+	case *batchv1beta1.CronJob:
+		_, err = client.BatchV1beta1().CronJobs(res.Namespace).Update(res)
+	case *batchv1.Job:
+		err = replaceJob(client, res)
+	default:
+		err = fmt.Errorf("unsupported workload type %T", obj)
+	}
+	return err
+}
+
+// Recreate a job with a changed pod template, because job templates can't be updated.
+func replaceJob(client *kubernetes.Clientset, job *batchv1.Job) error {
+	if err := deleteJob(client, job.Namespace, job.Name); err != nil {
+		return err
+	}
+	// Selector and controller labels are generated again for the new job
+	job.ObjectMeta = metav1.ObjectMeta{
+		Name:        job.Name,
+		Namespace:   job.Namespace,
+		Labels:      job.Labels,
+		Annotations: job.Annotations,
+	}
+	for _, l := range jobControllerLabels {
+		delete(job.Labels, l)
+		delete(job.Spec.Template.Labels, l)
+	}
+	job.Spec.Selector = nil
+	job.Spec.ManualSelector = nil
+	job.Status = batchv1.JobStatus{}
+	_, err := client.BatchV1().Jobs(job.Namespace).Create(job)
+	return err
+}
+
+// Delete a job with its pods and wait for it to be gone, so a job with the
+// same name can be created.
+func deleteJob(client *kubernetes.Clientset, namespace, name string) error {
+	jobs := client.BatchV1().Jobs(namespace)
+	policy := metav1.DeletePropagationBackground
+	err := jobs.Delete(name, &metav1.DeleteOptions{PropagationPolicy: &policy})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	deadline := time.Now().Add(jobDeleteTimeout)
+	for {
+		_, err := jobs.Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for job %v to be deleted", name)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Set the docker image of the workload's containers in a pod spec and return
+// the previous images keyed by container name.
+func setImages(spec *corev1.PodSpec, w Workload, docker string) (map[string]string, error) {
+	prev := make(map[string]string)
+	for _, name := range w.Containers {
+		if !setImage(spec.Containers, name, docker, prev) {
+			return prev, &ContainerNotFoundError{Kind: w.Kind, Workload: w.Name, Container: name}
+		}
+	}
+	for _, name := range w.InitContainers {
+		if !setImage(spec.InitContainers, name, docker, prev) {
+			return prev, &ContainerNotFoundError{Kind: w.Kind, Workload: w.Name, Container: name, Init: true}
+		}
+	}
+	return prev, nil
+}
+
+// Set the docker image of a named container, the previous image is stored in prev.
+func setImage(containers []corev1.Container, name, docker string, prev map[string]string) bool {
+	for i, c := range containers {
+		if c.Name == name {
+			prev[name] = c.Image
+			containers[i].Image = docker
+			return true
+		}
+	}
+	return false
+}
+
+// Check the rollout status of a workload the same way kubectl rollout status does.
+func rolloutComplete(client *kubernetes.Clientset, w Workload) (bool, error) {
+	obj, _, err := getWorkload(client, w)
+	if err != nil {
+		return false, err
+	}
+	switch res := obj.(type) {
+	case *appsv1.Deployment:
+		if res.Status.ObservedGeneration < res.Generation {
+			return false, nil
+		}
+		for _, c := range res.Status.Conditions {
+			if c.Type == appsv1.DeploymentProgressing && c.Reason == progressDeadlineExceeded {
+				return false, &ProgressDeadlineError{Namespace: res.Namespace, Name: res.Name}
+			}
+		}
+		complete := res.Status.UpdatedReplicas >= replicas(res.Spec.Replicas) &&
+			res.Status.Replicas == res.Status.UpdatedReplicas &&
+			res.Status.UnavailableReplicas == 0
+		// Paused Deployments don't roll out changes until they're resumed
+		if !complete && res.Spec.Paused {
+			return false, &PausedError{Namespace: res.Namespace, Name: res.Name}
+		}
+		return complete, nil
+	case *appsv1.StatefulSet:
+		// Pods of OnDelete StatefulSets are only updated when they're deleted
+		if res.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+			return true, nil
+		}
+		if res.Status.ObservedGeneration < res.Generation {
+			return false, nil
+		}
+		if res.Status.ReadyReplicas < replicas(res.Spec.Replicas) {
+			return false, nil
+		}
+		// Partitioned updates only replace pods with an ordinal at or above the partition
+		if ru := res.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil {
+			return res.Status.UpdatedReplicas >= replicas(res.Spec.Replicas)-*ru.Partition, nil
+		}
+		return res.Status.UpdateRevision == res.Status.CurrentRevision, nil
+	case *appsv1.DaemonSet:
+		// Pods of OnDelete DaemonSets are only updated when they're deleted
+		if res.Spec.UpdateStrategy.Type != appsv1.RollingUpdateDaemonSetStrategyType {
+			return true, nil
+		}
+		if res.Status.ObservedGeneration < res.Generation {
+			return false, nil
+		}
+		return res.Status.UpdatedNumberScheduled >= res.Status.DesiredNumberScheduled &&
+			res.Status.NumberUnavailable == 0, nil
+	case *batchv1.Job:
+		for _, c := range res.Status.Conditions {
+			if c.Status != corev1.ConditionTrue {
+				continue
+			}
+			if c.Type == batchv1.JobFailed {
+				return false, &JobFailedError{Namespace: res.Namespace, Name: res.Name}
+			}
+			if c.Type == batchv1.JobComplete {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	// CronJobs start new jobs with the updated template on their next schedule
+	return true, nil
+}
+
+// Roll back a workload to its previous pod template.
+func rollbackWorkload(client *kubernetes.Clientset, w Workload) error {
+	obj, _, err := getWorkload(client, w)
+	if err != nil {
+		return err
+	}
+	switch res := obj.(type) {
+	case *appsv1.Deployment:
+		return client.ExtensionsV1beta1().Deployments(w.Namespace).Rollback(&v1beta1.DeploymentRollback{
+			Name: w.Name,
+		})
+	case *appsv1.StatefulSet:
+		patch, err := previousRevision(client, res, res.Spec.Selector)
+		if err != nil {
+			return err
+		}
+		_, err = client.AppsV1().StatefulSets(w.Namespace).Patch(w.Name, types.StrategicMergePatchType, patch)
+		return err
+	case *appsv1.DaemonSet:
+		patch, err := previousRevision(client, res, res.Spec.Selector)
+		if err != nil {
+			return err
+		}
+		_, err = client.AppsV1().DaemonSets(w.Namespace).Patch(w.Name, types.StrategicMergePatchType, patch)
+		return err
+	}
+	return &RollbackUnsupportedError{Kind: w.Kind, Name: w.Name}
+}
+
+// Find the controller revision before the latest one of a StatefulSet or DaemonSet
+// and return its pod template patch.
+func previousRevision(client *kubernetes.Clientset, owner metav1.Object, selector *metav1.LabelSelector) ([]byte, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.AppsV1().ControllerRevisions(owner.GetNamespace()).List(metav1.ListOptions{
+		LabelSelector: sel.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var revisions []appsv1.ControllerRevision
+	for i := range res.Items {
+		if metav1.IsControlledBy(&res.Items[i], owner) {
+			revisions = append(revisions, res.Items[i])
+		}
+	}
+	if len(revisions) < 2 {
+		return nil, errNoPreviousRevision
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return revisions[len(revisions)-2].Data.Raw, nil
+}
+
+// Number of desired replicas, which defaults to one.
+func replicas(r *int32) int32 {
+	if r == nil {
+		return 1
+	}
+	return *r
+}